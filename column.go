@@ -0,0 +1,227 @@
+package exportcenter
+
+import (
+	"fmt"
+	"github.com/goccy/go-json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType 列类型，数据写入前按列类型转换，xlsx写入对应类型的单元格
+type ColumnType string
+
+const (
+	ColumnString   ColumnType = "string"   // 文本
+	ColumnInt      ColumnType = "int"      // 整数，xlsx默认格式为0，不使用科学计数法，超过15位时按文本写入避免丢失精度
+	ColumnDecimal  ColumnType = "decimal"  // 小数
+	ColumnDate     ColumnType = "date"     // 日期，支持日期字符串与时间戳，xlsx默认格式为yyyy-mm-dd
+	ColumnDatetime ColumnType = "datetime" // 日期时间，xlsx默认格式为yyyy-mm-dd hh:mm:ss
+	ColumnBool     ColumnType = "bool"     // 布尔值
+	ColumnPercent  ColumnType = "percent"  // 百分比，数据为小数，xlsx默认格式为0.00%
+)
+
+// 列对齐方式
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+// maxGeneralDigits excel常规格式完整显示的最大整数位数，超过后使用科学计数法
+const maxGeneralDigits = 11
+
+// maxNumberDigits excel数字的最大有效位数，超过后丢失精度
+const maxNumberDigits = 15
+
+// dateLayouts 日期字符串支持的格式
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02", "2006/01/02 15:04:05", "2006/01/02"}
+
+// Column 列配置，数据行为JSON对象时按Key取值写入对应的列
+type Column struct {
+	Header string     `json:"header"`            // 列标题
+	Key    string     `json:"key,omitempty"`     // 对象数据行的字段名，默认与列标题相同
+	Type   ColumnType `json:"type,omitempty"`    // 列类型，未配置时保持解析后的类型
+	NumFmt string     `json:"num_fmt,omitempty"` // excel数字格式，如#,##0.00，未配置时使用列类型的默认格式
+	Width  float64    `json:"width,omitempty"`   // 列宽，仅xlsx有效
+	Align  string     `json:"align,omitempty"`   // 水平对齐方式left、center、right，仅xlsx有效
+}
+
+// normalize 配置了多级表头时使用叶子节点的标题作为表头，未配置表头时使用列标题
+func (o *ExportOptions) normalize() {
+	if len(o.HeaderTree) > 0 {
+		o.Header = headerLeaves(o.HeaderTree, nil)
+		return
+	}
+	if len(o.Header) > 0 || len(o.Columns) == 0 {
+		return
+	}
+	o.Header = make([]string, 0, len(o.Columns))
+	for _, column := range o.Columns {
+		o.Header = append(o.Header, column.Header)
+	}
+}
+
+// columnKeys 对象数据行各列的字段名，未配置列时使用表头
+func (o *ExportOptions) columnKeys() []string {
+	if len(o.Columns) == 0 {
+		return o.Header
+	}
+	keys := make([]string, 0, len(o.Columns))
+	for _, column := range o.Columns {
+		if column.Key == "" {
+			keys = append(keys, column.Header)
+		} else {
+			keys = append(keys, column.Key)
+		}
+	}
+	return keys
+}
+
+// defaultNumFmt 列类型的默认excel数字格式
+func (c Column) defaultNumFmt() string {
+	if c.NumFmt != "" {
+		return c.NumFmt
+	}
+	switch c.Type {
+	case ColumnInt:
+		return "0"
+	case ColumnDate:
+		return "yyyy-mm-dd"
+	case ColumnDatetime:
+		return "yyyy-mm-dd hh:mm:ss"
+	case ColumnPercent:
+		return "0.00%"
+	}
+	return ""
+}
+
+// timeCell 日期时间单元格，xlsx写入日期值，文本格式按layout输出
+type timeCell struct {
+	t      time.Time
+	layout string
+}
+
+func (c timeCell) String() string {
+	return c.t.Format(c.layout)
+}
+
+func (c timeCell) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// convertCell 按列类型转换单元格的值，空值与空字符串转换为nil
+func convertCell(value interface{}, typ ColumnType) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if s, ok := value.(string); ok && s == "" && typ != ColumnString {
+		return nil, nil
+	}
+
+	switch typ {
+	case "":
+		// 未配置类型时保留解析的值，长整数由xlsx写入器按文本写入
+		return value, nil
+	case ColumnString:
+		return cellString(value), nil
+	case ColumnInt:
+		switch v := value.(type) {
+		case json.Number:
+			return convertInt(v.String())
+		case string:
+			return convertInt(strings.TrimSpace(v))
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		}
+	case ColumnDecimal, ColumnPercent:
+		switch v := value.(type) {
+		case json.Number:
+			return v.Float64()
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		case float64:
+			return v, nil
+		}
+	case ColumnDate, ColumnDatetime:
+		layout := "2006-01-02"
+		if typ == ColumnDatetime {
+			layout = "2006-01-02 15:04:05"
+		}
+		switch v := value.(type) {
+		case string:
+			for _, l := range dateLayouts {
+				if t, err := time.ParseInLocation(l, strings.TrimSpace(v), time.Local); err == nil {
+					return timeCell{t: t, layout: layout}, nil
+				}
+			}
+		case json.Number:
+			ts, err := v.Int64()
+			if err != nil {
+				break
+			}
+			return timeCell{t: unixTime(ts), layout: layout}, nil
+		case float64:
+			return timeCell{t: unixTime(int64(v)), layout: layout}, nil
+		}
+	case ColumnBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		case json.Number:
+			return strconv.ParseBool(v.String())
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("不支持的列类型：%s", typ)
+	}
+	return nil, fmt.Errorf("无法将%v转换为%s", value, typ)
+}
+
+// generalCell 转换xlsx未配置类型的单元格，整数超过常规格式的显示位数时按文本写入，避免精度丢失与科学计数法
+func generalCell(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		s := v.String()
+		if !strings.ContainsAny(s, ".eE") && len(strings.TrimPrefix(s, "-")) > maxGeneralDigits {
+			return s
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return s
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) >= 1e11 {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return value
+}
+
+// unixTime 时间戳转换为时间，超过1e11时为毫秒
+func unixTime(ts int64) time.Time {
+	if ts > 1e11 || ts < -1e11 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
+
+// convertInt 转换整数，超过excel数字的有效位数时返回文本
+func convertInt(s string) (interface{}, error) {
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return nil, fmt.Errorf("无法将%s转换为%s", s, ColumnInt)
+	}
+	if len(digits) > maxNumberDigits {
+		return s, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,353 @@
+package exportcenter
+
+import (
+	"context"
+	"fmt"
+	"github.com/panjf2000/ants/v2"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// consumeSheets 按数据表并发消费队列，每个数据表对应一个队列，返回任务是否完成
+func (ec *ExportCenter) consumeSheets(ctx context.Context, task Task, decoder *rowDecoder, namer *sheetNamer, writer Writer, prog *progress, before func(key string) error, log *logrus.Logger) (bool, error) {
+	// 根据数据量，计算导出任务的数据队列数量
+	sheetCount := int(math.Ceil(float64(task.CountNum) / float64(ec.sheetMaxRows)))
+
+	// 数据表写入器字典
+	swMap := make(map[int32]SheetWriter, 0)
+
+	for i := 1; i <= sheetCount; i++ {
+		queueKey := ec.sheetQueueKey(task.QueueKey, i)
+
+		if before != nil {
+			err := before(queueKey)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		// 获取写入器
+		sw, err := writer.NewSheet(namer.name(i))
+		if err != nil {
+			return false, err
+		}
+		swMap[int32(i)] = sw
+	}
+
+	closedCount := int64(0) // 已收到结束标记或已写满的数据表数量
+	var idleErr error       // 等待结束标记时队列空闲超时
+	var idleOnce sync.Once
+
+	// 创建并发工作组，在工作组中使用协程处理数据写入，单个协程会有一个小时的过期时间，一个小时内未完成单表设置的最大数量就会任务失败
+	var wg sync.WaitGroup
+	p, _ := ants.NewPoolWithFunc(ec.poolMax, func(sheetIndex interface{}) {
+		defer wg.Done()
+
+		currentSheetIndex := sheetIndex.(int32)
+		queueKey := ec.sheetQueueKey(task.QueueKey, int(currentSheetIndex))
+		sw := swMap[currentSheetIndex]
+
+		// 当前数据表已写入行数
+		rowCount := int64(0)
+		// 最后收到数据的时间
+		lastData := time.Now()
+		// 拉取队列数据，队列返回长期有效的数据通道
+		list := ec.PopData(queueKey)
+		for {
+			currentRowNum := rowCount + 2 // 当前行，首行为标题
+			currentCount := atomic.LoadInt64(&prog.count)
+
+			out := false
+			idle := false
+			var rows, failed int64
+			select {
+			case data, ok := <-list:
+				if !ok {
+					// 队列已销毁
+					log.Error(fmt.Sprintf("%s队列已销毁", queueKey))
+					out = true
+					break
+				}
+				lastData = time.Now()
+				if data == EndOfStream {
+					// 数据流结束
+					out = true
+					atomic.AddInt64(&closedCount, 1)
+					ec.ackData(queueKey, data, log)
+					break
+				}
+				rows, failed = ec.writeData(decoder, queueKey, sw, data, log)
+			case <-ctx.Done():
+				// 任务取消
+				out = true
+				break
+			case <-time.After(ec.outTime):
+				if ec.waitClose {
+					// 等待结束标记，任务已达到数据量时结束，超过最长空闲时间任务失败，否则继续等待
+					out = atomic.LoadInt64(&prog.count) >= task.CountNum
+					if !out && time.Since(lastData) >= ec.idleTimeout {
+						out = true
+						idleOnce.Do(func() { idleErr = ec.idleError(queueKey, log) })
+					}
+					idle = !out
+					break
+				}
+				out = true
+				outErr := fmt.Sprintf("%d行写入数据超时", currentRowNum)
+				fmt.Println(outErr)
+				log.WithFields(logrus.Fields{
+					"currentRowNum": currentRowNum,
+					"count":         currentCount,
+				}).Error(outErr)
+				break
+			}
+
+			if out {
+				break
+			}
+			if idle {
+				continue
+			}
+
+			// 增加数据到当前sheet并记录当前数据行索引，达到限制新增sheet
+			ec.addProgress(prog, rows, failed) // 记录数据进度
+			rowCount += rows
+			if rowCount >= ec.sheetMaxRows {
+				// 数据表已写满，不再读取队列的结束标记，按已结束计算
+				atomic.AddInt64(&closedCount, 1)
+				break
+			}
+			if currentCount+rows >= task.CountNum {
+				break
+			}
+		}
+
+		if err := sw.Flush(); err != nil {
+			log.Error(err)
+		}
+	}, ants.WithExpiryDuration(3600), ants.WithMaxBlockingTasks(ec.goroutineMax), ants.WithLogger(log))
+	defer p.Release()
+	// 提交协程任务
+	for i := 0; i < sheetCount; i++ {
+		wg.Add(1)
+		_ = p.Invoke(int32(i + 1))
+	}
+	wg.Wait()
+
+	completed := atomic.LoadInt64(&prog.count) >= task.CountNum || atomic.LoadInt64(&closedCount) == int64(sheetCount)
+	if !completed && idleErr != nil {
+		return false, idleErr
+	}
+	return completed, nil
+}
+
+// consumeStream 消费流式任务的单个队列，数据表达到最大行数时自动新增数据表，收到结束标记后任务完成
+func (ec *ExportCenter) consumeStream(ctx context.Context, task Task, decoder *rowDecoder, namer *sheetNamer, writer Writer, prog *progress, before func(key string) error, log *logrus.Logger) (bool, error) {
+	queueKey := ec.streamQueueKey(task.QueueKey)
+	if before != nil {
+		err := before(queueKey)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	sheetIndex := 1
+	sw, err := writer.NewSheet(namer.name(sheetIndex))
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := sw.Flush(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	// 当前数据表已写入行数
+	rowCount := int64(0)
+	list := ec.PopData(queueKey)
+	for {
+		select {
+		case data, ok := <-list:
+			if !ok {
+				// 队列已销毁
+				log.Error(fmt.Sprintf("%s队列已销毁", queueKey))
+				return false, nil
+			}
+			if data == EndOfStream {
+				// 数据流结束
+				ec.ackData(queueKey, data, log)
+				return true, nil
+			}
+
+			rows, err := decoder.decode(data)
+			if err != nil {
+				log.Error(err)
+				ec.rejectData(queueKey, data, err, log)
+				ec.addProgress(prog, 1, 1) // 记录数据进度
+				continue
+			}
+
+			var failed int64
+			for _, row := range rows {
+				// 达到数据表最大行数，新增数据表
+				if rowCount >= ec.sheetMaxRows {
+					if err = sw.Flush(); err != nil {
+						return false, err
+					}
+					sheetIndex++
+					sw, err = writer.NewSheet(namer.name(sheetIndex))
+					if err != nil {
+						return false, err
+					}
+					rowCount = 0
+				}
+
+				if err = sw.WriteRow(row); err != nil {
+					log.Error(err)
+					failed++
+				}
+				rowCount++
+			}
+			ec.ackData(queueKey, data, log)
+			ec.addProgress(prog, int64(len(rows)), failed) // 记录数据进度
+		case <-ctx.Done():
+			// 任务取消
+			return false, nil
+		case <-time.After(ec.idleTimeout):
+			// 生产者异常退出时不会推送结束标记，超过最长空闲时间任务失败
+			return false, ec.idleError(queueKey, log)
+		}
+	}
+}
+
+// consumePartitions 并发消费分区任务的所有队列，数据行由分区写入器按分区列的值写入对应的数据表
+// 所有队列都收到结束标记，或者非流式任务的数据量达到总数时任务完成
+func (ec *ExportCenter) consumePartitions(ctx context.Context, task Task, decoder *rowDecoder, pw *partitionWriter, prog *progress, before func(key string) error, log *logrus.Logger) (bool, error) {
+	keys := ec.taskQueueKeys(task)
+	if before != nil {
+		for _, queueKey := range keys {
+			if err := before(queueKey); err != nil {
+				return false, err
+			}
+		}
+	}
+	defer func() {
+		if err := pw.Flush(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	// 数据量达到总数时通知所有消费协程退出
+	done := make(chan struct{})
+	var doneOnce sync.Once
+	closedCount := int64(0) // 已收到结束标记的队列数量
+	var idleErr error       // 等待结束标记时队列空闲超时
+	var idleOnce sync.Once
+
+	// 流式任务与等待结束标记时，超过最长空闲时间没有数据任务失败，否则超时退出
+	timeout := ec.outTime
+	if task.isStream() || ec.waitClose {
+		timeout = ec.idleTimeout
+	}
+
+	var wg sync.WaitGroup
+	for _, queueKey := range keys {
+		wg.Add(1)
+		go func(queueKey string) {
+			defer wg.Done()
+
+			list := ec.PopData(queueKey)
+			for {
+				select {
+				case data, ok := <-list:
+					if !ok {
+						// 队列已销毁
+						log.Error(fmt.Sprintf("%s队列已销毁", queueKey))
+						return
+					}
+					if data == EndOfStream {
+						// 数据流结束
+						atomic.AddInt64(&closedCount, 1)
+						ec.ackData(queueKey, data, log)
+						return
+					}
+					rows, failed := ec.writeData(decoder, queueKey, pw, data, log)
+					ec.addProgress(prog, rows, failed) // 记录数据进度
+					if !task.isStream() && atomic.LoadInt64(&prog.count) >= task.CountNum {
+						doneOnce.Do(func() { close(done) })
+						return
+					}
+				case <-done:
+					return
+				case <-ctx.Done():
+					// 任务取消
+					return
+				case <-time.After(timeout):
+					if task.isStream() || ec.waitClose {
+						idleOnce.Do(func() { idleErr = ec.idleError(queueKey, log) })
+						doneOnce.Do(func() { close(done) })
+						return
+					}
+					outErr := fmt.Sprintf("%s队列写入数据超时", queueKey)
+					log.WithFields(logrus.Fields{
+						"count": atomic.LoadInt64(&prog.count),
+					}).Error(outErr)
+					return
+				}
+			}
+		}(queueKey)
+	}
+	wg.Wait()
+
+	completed := atomic.LoadInt64(&closedCount) == int64(len(keys)) ||
+		!task.isStream() && atomic.LoadInt64(&prog.count) >= task.CountNum
+	if !completed && idleErr != nil {
+		return false, idleErr
+	}
+	return completed, nil
+}
+
+// idleError 记录队列空闲超时日志并返回错误
+func (ec *ExportCenter) idleError(queueKey string, log *logrus.Logger) error {
+	err := fmt.Errorf("%s队列超过%s没有数据：%w", queueKey, ec.idleTimeout, ErrIdleTimeout)
+	log.Error(err)
+	return err
+}
+
+// writeData 解析一条队列数据并写入数据表，返回处理的行数与失败的行数，失败时记录日志
+// 写入后确认数据，无法解析的数据按一行失败计算并拒绝，由支持拒绝的队列转入死信队列
+func (ec *ExportCenter) writeData(decoder *rowDecoder, key string, sw SheetWriter, data string, log *logrus.Logger) (rows, failed int64) {
+	values, err := decoder.decode(data)
+	if err != nil {
+		log.Error(err)
+		ec.rejectData(key, data, err, log)
+		return 1, 1
+	}
+
+	// 写入文件
+	for _, row := range values {
+		if err = sw.WriteRow(row); err != nil {
+			log.Error(err)
+			failed++
+		}
+	}
+	ec.ackData(key, data, log)
+	return int64(len(values)), failed
+}
+
+// ackData 确认数据，写入失败的数据已记录日志，同样确认避免重复投递
+func (ec *ExportCenter) ackData(key string, data string, log *logrus.Logger) {
+	if err := ec.AckData(key, data); err != nil {
+		log.Error(err)
+	}
+}
+
+// rejectData 拒绝无法解析的数据
+func (ec *ExportCenter) rejectData(key string, data string, reason error, log *logrus.Logger) {
+	if err := ec.RejectData(key, data, reason); err != nil {
+		log.Error(err)
+	}
+}
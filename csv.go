@@ -0,0 +1,308 @@
+package exportcenter
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// csv引号模式
+const (
+	CsvQuoteMinimal    = "minimal"     // 仅在字段包含分隔符、引号、换行或首尾空格时加引号
+	CsvQuoteAll        = "all"         // 所有字段都加引号
+	CsvQuoteNonNumeric = "non_numeric" // 非数字字段加引号
+)
+
+// csv文件编码
+const (
+	CsvEncodingUtf8 = "utf-8"
+	CsvEncodingGbk  = "gbk"
+)
+
+// CsvOptions csv导出选项
+type CsvOptions struct {
+	Delimiter string `json:"delimiter"` // 分隔符，默认逗号
+	Quote     string `json:"quote"`     // 引号模式，默认minimal
+	LineEnd   string `json:"line_end"`  // 换行符，默认\r\n
+	Bom       bool   `json:"bom"`       // 是否写入UTF-8 BOM，excel打开时能正确识别中文，GBK编码时无效
+	Encoding  string `json:"encoding"`  // 文件编码，支持utf-8（默认）、gbk
+}
+
+// csvEntryReplacer 替换zip中文件名不允许的字符，数据表名称已替换excel不允许的字符
+var csvEntryReplacer = strings.NewReplacer("\"", "_", "<", "_", ">", "_", "|", "_")
+
+// csvWriter csv写入器，每个数据表写入单独的文件，多个数据表时打包成zip
+type csvWriter struct {
+	filePath  string
+	options   CsvOptions
+	delimiter rune
+	header    []string
+	parts     []*csvSheet
+	lock      sync.Mutex
+}
+
+func (w *csvWriter) Open(filePath string, options ExportOptions) error {
+	w.filePath = filePath
+	w.header = options.Header
+	if options.Csv != nil {
+		w.options = *options.Csv
+	}
+
+	w.delimiter = ','
+	if w.options.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(w.options.Delimiter)
+		if size != len(w.options.Delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return fmt.Errorf("csv分隔符不合法：%q", w.options.Delimiter)
+		}
+		w.delimiter = r
+	}
+	if w.options.LineEnd == "" {
+		w.options.LineEnd = "\r\n"
+	}
+	switch strings.ToLower(w.options.Quote) {
+	case "":
+		w.options.Quote = CsvQuoteMinimal
+	case CsvQuoteMinimal, CsvQuoteAll, CsvQuoteNonNumeric:
+		w.options.Quote = strings.ToLower(w.options.Quote)
+	default:
+		return fmt.Errorf("不支持的csv引号模式：%s", w.options.Quote)
+	}
+	switch strings.ToLower(w.options.Encoding) {
+	case "", "utf8", CsvEncodingUtf8:
+		w.options.Encoding = CsvEncodingUtf8
+	case CsvEncodingGbk:
+		w.options.Encoding = CsvEncodingGbk
+	default:
+		return fmt.Errorf("不支持的csv编码：%s", w.options.Encoding)
+	}
+	return nil
+}
+
+func (w *csvWriter) NewSheet(name string) (SheetWriter, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// 分片文件与目标文件放在同一目录，保存时直接重命名或打包
+	partPath := fmt.Sprintf("%s.part%d", w.filePath, len(w.parts)+1)
+	file, err := os.Create(partPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &csvSheet{w: w, name: name, path: partPath, file: file, buf: bufio.NewWriter(file)}
+	if w.options.Encoding == CsvEncodingGbk {
+		sheet.encoder = simplifiedchinese.GBK.NewEncoder()
+	}
+	w.parts = append(w.parts, sheet)
+
+	if w.options.Bom && w.options.Encoding == CsvEncodingUtf8 {
+		if _, err = file.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+			return nil, err
+		}
+	}
+	if len(w.header) > 0 {
+		if err = sheet.writeRecord(w.header); err != nil {
+			return nil, err
+		}
+	}
+	return sheet, nil
+}
+
+// Save 保存文件，只有一个数据表时直接生成csv文件，多个数据表时打包成zip（文件扩展名替换为.zip）
+// zip中的文件以数据表名称命名，数据表名称为空时使用<文件名>_<序号>
+func (w *csvWriter) Save() (string, error) {
+	if len(w.parts) == 0 {
+		// 没有数据时也生成仅包含表头的文件
+		if _, err := w.NewSheet(""); err != nil {
+			return "", err
+		}
+	}
+
+	for _, part := range w.parts {
+		if err := part.close(); err != nil {
+			return "", err
+		}
+	}
+
+	if len(w.parts) == 1 {
+		return w.filePath, os.Rename(w.parts[0].path, w.filePath)
+	}
+
+	ext := filepath.Ext(w.filePath)
+	base := strings.TrimSuffix(filepath.Base(w.filePath), ext)
+	if ext == "" || strings.EqualFold(ext, ".zip") {
+		ext = ".csv"
+	}
+	zipPath := strings.TrimSuffix(w.filePath, filepath.Ext(w.filePath)) + ".zip"
+
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer zipFile.Close()
+
+	zw := zip.NewWriter(zipFile)
+	used := make(map[string]struct{}, len(w.parts))
+	for i, part := range w.parts {
+		name := strings.TrimSpace(csvEntryReplacer.Replace(part.name))
+		if name == "" {
+			name = fmt.Sprintf("%s_%d", base, i+1)
+		}
+		// 替换字符后可能重名，重名时增加序号
+		unique := name
+		for n := 2; ; n++ {
+			if _, ok := used[strings.ToLower(unique)]; !ok {
+				break
+			}
+			unique = fmt.Sprintf("%s (%d)", name, n)
+		}
+		used[strings.ToLower(unique)] = struct{}{}
+
+		entry, err := zw.Create(unique + ext)
+		if err != nil {
+			return "", err
+		}
+		file, err := os.Open(part.path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(entry, file)
+		_ = file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return "", err
+	}
+
+	// 删除分片文件
+	for _, part := range w.parts {
+		_ = os.Remove(part.path)
+	}
+	return zipPath, zipFile.Close()
+}
+
+// Close 关闭并清理未保存的分片文件
+func (w *csvWriter) Close() error {
+	var err error
+	for _, part := range w.parts {
+		if e := part.close(); e != nil && err == nil {
+			err = e
+		}
+		_ = os.Remove(part.path)
+	}
+	return err
+}
+
+// csvSheet csv数据表，对应一个分片文件
+type csvSheet struct {
+	w       *csvWriter
+	name    string // 数据表名称，打包成zip时作为文件名
+	path    string
+	file    *os.File
+	encoder *encoding.Encoder // 按行转码，无法编码的行返回错误，不影响其他行
+	buf     *bufio.Writer
+	record  []string
+	line    []byte
+}
+
+func (s *csvSheet) WriteRow(values []interface{}) error {
+	s.record = s.record[:0]
+	for _, value := range values {
+		s.record = append(s.record, cellString(value))
+	}
+	return s.writeRecord(s.record)
+}
+
+func (s *csvSheet) Flush() error {
+	return s.buf.Flush()
+}
+
+// writeRecord 按配置的分隔符、引号模式和换行符写入一行，GBK编码时整行转码后写入
+func (s *csvSheet) writeRecord(record []string) error {
+	line := s.line[:0]
+	for i, field := range record {
+		if i > 0 {
+			line = utf8.AppendRune(line, s.w.delimiter)
+		}
+		if !s.needQuote(field) {
+			line = append(line, field...)
+			continue
+		}
+		line = append(line, '"')
+		line = append(line, strings.ReplaceAll(field, `"`, `""`)...)
+		line = append(line, '"')
+	}
+	line = append(line, s.w.options.LineEnd...)
+	s.line = line
+
+	if s.encoder != nil {
+		encoded, err := s.encoder.Bytes(line)
+		if err != nil {
+			return fmt.Errorf("数据包含无法使用GBK编码的字符：%w", err)
+		}
+		line = encoded
+	}
+	_, err := s.buf.Write(line)
+	return err
+}
+
+func (s *csvSheet) needQuote(field string) bool {
+	switch s.w.options.Quote {
+	case CsvQuoteAll:
+		return true
+	case CsvQuoteNonNumeric:
+		if !isNumeric(field) {
+			return true
+		}
+	}
+
+	if field == "" {
+		return false
+	}
+	if strings.ContainsRune(field, s.w.delimiter) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return r == ' ' || r == '\t'
+}
+
+func (s *csvSheet) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.buf.Flush()
+	if e := s.file.Close(); err == nil {
+		err = e
+	}
+	s.file = nil
+	return err
+}
+
+// isNumeric 判断字段是否为数字
+func isNumeric(field string) bool {
+	if field == "" {
+		return false
+	}
+	dot := false
+	for i, r := range field {
+		switch {
+		case r >= '0' && r <= '9':
+		case (r == '-' || r == '+') && i == 0 && len(field) > 1:
+		case r == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return true
+}
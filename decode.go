@@ -0,0 +1,168 @@
+package exportcenter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"sort"
+	"strings"
+)
+
+// errEmptyData 队列数据为空
+var errEmptyData = errors.New("队列数据为空")
+
+// errInvalidRow 数据行不是数组或对象
+var errInvalidRow = errors.New("数据行必须是JSON数组或对象")
+
+// errNoColumns 对象数据行未配置列
+var errNoColumns = errors.New("对象数据行需要配置列或表头")
+
+// rowDecoder 队列数据解析器，每个导出任务创建一个
+type rowDecoder struct {
+	ec     *ExportCenter
+	taskID int64
+	keys   []string       // 对象数据行各列的字段名
+	index  map[string]int // 字段名对应的列索引
+	types  []ColumnType   // 各列的类型
+	strict bool
+}
+
+func (ec *ExportCenter) newRowDecoder(task Task, options ExportOptions) *rowDecoder {
+	keys := options.columnKeys()
+	index := make(map[string]int, len(keys))
+	for i, key := range keys {
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+	types := make([]ColumnType, 0, len(options.Columns))
+	for _, column := range options.Columns {
+		types = append(types, column.Type)
+	}
+	return &rowDecoder{
+		ec:     ec,
+		taskID: int64(task.ID),
+		keys:   keys,
+		index:  index,
+		types:  types,
+		strict: options.StrictKeys,
+	}
+}
+
+// decode 解析队列数据并按列类型转换，多行消息返回所有数据行
+func (d *rowDecoder) decode(data string) ([][]interface{}, error) {
+	rows, err := d.parse(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			var typ ColumnType
+			if i < len(d.types) {
+				typ = d.types[i]
+			}
+			row[i], err = convertCell(value, typ)
+			if err != nil {
+				return nil, fmt.Errorf("第%d列：%w", i+1, err)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// parse 解析队列数据，数组直接解析为数据行，对象按列的字段名取值，缺少的字段为空值，其他数据返回错误
+func (d *rowDecoder) parse(data string) ([][]interface{}, error) {
+	// 忽略开头的空白字符后按首个字符区分数据格式
+	data = strings.TrimLeft(data, " \t\r\n")
+	if data == "" {
+		return nil, errEmptyData
+	}
+
+	if strings.HasPrefix(data, envelopePrefix) {
+		var envelope Envelope
+		err := unmarshal(data, &envelope)
+		if err != nil {
+			return nil, err
+		}
+		if envelope.Version != EnvelopeVersion {
+			return nil, fmt.Errorf("不支持的多行消息版本%d", envelope.Version)
+		}
+		if envelope.TaskID != 0 && envelope.TaskID != d.taskID {
+			return nil, fmt.Errorf("多行消息任务ID%d与导出任务%d不一致，序号%d", envelope.TaskID, d.taskID, envelope.Seq)
+		}
+		return envelope.Rows, nil
+	}
+
+	switch data[0] {
+	case '[':
+		var row []interface{}
+		err := unmarshal(data, &row)
+		if err != nil {
+			return nil, err
+		}
+		return [][]interface{}{row}, nil
+	case '{':
+		row, err := d.decodeObject(data)
+		if err != nil {
+			return nil, err
+		}
+		return [][]interface{}{row}, nil
+	}
+	return nil, errInvalidRow
+}
+
+// decodeObject 按列的字段名将对象数据行转换为数组，开启StrictKeys时未配置的字段返回错误
+func (d *rowDecoder) decodeObject(data string) ([]interface{}, error) {
+	if len(d.keys) == 0 {
+		return nil, errNoColumns
+	}
+
+	var object map[string]interface{}
+	err := unmarshal(data, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]interface{}, len(d.keys))
+	var unknown []string
+	for key, value := range object {
+		i, ok := d.index[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		row[i] = value
+	}
+	if d.strict && len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("数据行包含未配置的字段：%s", strings.Join(unknown, ","))
+	}
+	return row, nil
+}
+
+// unmarshal 解析json，包含超过excel有效位数的数字时保留为json.Number，避免长整数转换为浮点数后丢失精度
+// 其他数据直接解析为float64，减少内存分配
+func unmarshal(data string, v interface{}) error {
+	if !hasLongNumber(data) {
+		return json.Unmarshal([]byte(data), v)
+	}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// hasLongNumber 是否包含超过maxNumberDigits位的连续数字
+func hasLongNumber(data string) bool {
+	digits := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] >= '0' && data[i] <= '9' {
+			digits++
+			if digits > maxNumberDigits {
+				return true
+			}
+		} else {
+			digits = 0
+		}
+	}
+	return false
+}
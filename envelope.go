@@ -0,0 +1,30 @@
+package exportcenter
+
+import (
+	"github.com/goccy/go-json"
+)
+
+// EnvelopeVersion 当前多行消息格式版本
+const EnvelopeVersion = 1
+
+// envelopePrefix 多行消息前缀，版本字段必须位于消息开头，用于与单行数据区分
+const envelopePrefix = `{"_ec":`
+
+// Envelope 多行消息，一条队列消息携带多行数据，减少推送与拉取的次数
+// 格式为 {"_ec":1,"task_id":1,"seq":1,"rows":[[...],[...]]}，其他语言的生产者需保证_ec位于开头
+type Envelope struct {
+	Version int             `json:"_ec"`     // 格式版本
+	TaskID  int64           `json:"task_id"` // 任务ID，与导出任务不一致时拒绝，为0时不校验
+	Seq     int64           `json:"seq"`     // 消息序号，由生产者递增，用于排查数据缺失或重复
+	Rows    [][]interface{} `json:"rows"`    // 数据行
+}
+
+// PushEnvelope 推送多行消息，自动填充格式版本
+func (ec *ExportCenter) PushEnvelope(key string, envelope Envelope) error {
+	envelope.Version = EnvelopeVersion
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return ec.PushData(key, string(data))
+}
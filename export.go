@@ -5,58 +5,103 @@ import (
 	"errors"
 	"fmt"
 	"github.com/goccy/go-json"
-	"github.com/panjf2000/ants/v2"
 	"github.com/sirupsen/logrus"
-	"github.com/xuri/excelize/v2"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"gorm.io/gorm"
 	"math"
 	"os"
-	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-var DbClient *gorm.DB
+// UnknownCount 数据总数未知，创建流式任务使用
+const UnknownCount int64 = -1
 
-var startSignal sync.Map
+// EndOfStream 数据流结束标记，推送到队列后表示该队列的数据已全部推送完成
+const EndOfStream = "\x00exportcenter:end-of-stream"
+
+var (
+	ErrTaskCanceled = errors.New("任务已取消")
+	ErrTaskFinished = errors.New("任务已结束")
+	ErrIdleTimeout  = errors.New("队列空闲超时")
+)
 
 type ExportCenter struct {
-	Db            *gorm.DB
-	Queue         Queue
-	queuePrefix   string
-	sheetMaxRows  int64
-	poolMax       int
-	goroutineMax  int
-	isUploadCloud bool
-	upload        func(filePath string) (string, error)
-	logRootPath   string
-	outTime       time.Duration
+	Db               *gorm.DB
+	Queue            Queue
+	store            TaskStore
+	signaler         Signaler
+	queuePrefix      string
+	sheetMaxRows     int64
+	poolMax          int
+	goroutineMax     int
+	isUploadCloud    bool
+	upload           func(filePath string) (string, error)
+	logRootPath      string
+	outTime          time.Duration
+	waitClose        bool
+	idleTimeout      time.Duration
+	startTimeout     time.Duration
+	progressInterval time.Duration
+	progressRows     int64
+	running          sync.Map // 当前进程正在导出的任务
+}
+
+// runningTask 正在导出的任务
+type runningTask struct {
+	cancel   context.CancelFunc       // 取消导出
+	done     chan struct{}            // 导出结束（包括取消后的清理）时关闭
+	progress atomic.Pointer[progress] // 实时进度，开始消费数据后设置
 }
 
 // Options 配置
 type Options struct {
-	Db            *gorm.DB                              // gorm实例
-	QueuePrefix   string                                // 队列前缀
-	Queue         Queue                                 // 队列配置（必须配置）
-	SheetMaxRows  int64                                 // 数据表最大行数，用于生成队列key，可以用不同的队列同时并发写入数据，队列数量由【任务数据量】/【数据表最大行数】计算所得
-	PoolMax       int                                   // 协程池最大数量
-	GoroutineMax  int                                   // 协程最大数量
-	IsUploadCloud bool                                  // 是否上传云端
-	Upload        func(filePath string) (string, error) // 上传接口
-	LogRootPath   string                                // 日志存储根目录
-	OutTime       time.Duration                         // 超时时间
+	Db               *gorm.DB                              // gorm实例，未配置Store时使用gorm存储任务
+	Store            TaskStore                             // 任务存储，优先于Db
+	QueuePrefix      string                                // 队列前缀
+	Queue            Queue                                 // 队列配置（必须配置）
+	Signaler         Signaler                              // 任务开启信号，默认为进程内信号，生产者与导出服务分开部署时需配置跨进程的信号
+	SheetMaxRows     int64                                 // 数据表最大行数，用于生成队列key，可以用不同的队列同时并发写入数据，队列数量由【任务数据量】/【数据表最大行数】计算所得
+	PoolMax          int                                   // 协程池最大数量
+	GoroutineMax     int                                   // 协程最大数量
+	IsUploadCloud    bool                                  // 是否上传云端
+	Upload           func(filePath string) (string, error) // 上传接口
+	LogRootPath      string                                // 日志存储根目录
+	OutTime          time.Duration                         // 超时时间
+	WaitClose        bool                                  // 等待结束标记，开启后数据表只在收到CloseQueue结束标记或达到数据量后完成，OutTime不再判定超时
+	IdleTimeout      time.Duration                         // 流式任务以及开启WaitClose时队列的最长空闲时间，超过该时间没有收到数据任务失败，开启WaitClose时默认1小时，否则默认为OutTime
+	StartTimeout     time.Duration                         // 等待任务开启信号的超时时间，默认1分钟
+	ProgressInterval time.Duration                         // 进度更新时间间隔，默认1秒
+	ProgressRows     int64                                 // 进度更新行数间隔，每处理指定行数立即更新一次进度，默认只按时间间隔更新
 }
 
 // Queue 队列
 type Queue interface {
 	CreateQueue(ctx context.Context, key string) error       // 创建队列
-	Pop(ctx context.Context, key string) <-chan string       // 拉取数据
+	Pop(ctx context.Context, key string) <-chan string       // 拉取数据，返回队列长期有效的数据通道，导出协程只调用一次，通道关闭表示队列已销毁
 	Push(ctx context.Context, key string, data string) error // 推送数据
 	Destroy(ctx context.Context, key string) error           // 删除队列
 }
 
+// AckQueue 支持确认的队列，导出协程将数据写入文件后确认，未确认的数据由队列在消费者异常退出后重新投递
+type AckQueue interface {
+	Queue
+	Ack(ctx context.Context, key string, data string) error // 确认数据已处理
+}
+
+// BatchQueue 支持批量推送的队列，减少推送大量数据时的网络往返
+type BatchQueue interface {
+	Queue
+	PushBatch(ctx context.Context, key string, data []string) error // 批量推送数据，保持数据顺序
+}
+
+// RejectQueue 支持拒绝的队列，无法解析的数据被拒绝，由队列保存到死信队列供排查或重放
+type RejectQueue interface {
+	Queue
+	Reject(ctx context.Context, key string, data string, reason error) error // 拒绝数据，reason为拒绝原因
+}
+
 func NewClient(options Options) (*ExportCenter, error) {
 	if options.SheetMaxRows == 0 {
 		return nil, errors.New("SheetMaxRows数据表最大行数必须配置大于0")
@@ -70,35 +115,98 @@ func NewClient(options Options) (*ExportCenter, error) {
 	if options.OutTime == 0 {
 		options.OutTime = 5 * time.Second // 默认超时时间
 	}
+	if options.IdleTimeout <= 0 {
+		// 等待结束标记时生产者可能推送较慢，默认空闲时间更长
+		options.IdleTimeout = options.OutTime
+		if options.WaitClose {
+			options.IdleTimeout = time.Hour
+		}
+	}
+	if options.StartTimeout <= 0 {
+		options.StartTimeout = time.Minute // 默认开启任务超时时间
+	}
+	if options.Signaler == nil {
+		options.Signaler = NewMemorySignaler()
+	}
+	if options.ProgressInterval <= 0 {
+		options.ProgressInterval = time.Second // 默认进度更新间隔
+	}
 
-	DbClient = options.Db
+	if options.Store == nil {
+		if options.Db == nil {
+			return nil, errors.New("Store任务存储或Db数据库实例必须配置")
+		}
 
-	// 自动创建任务表
-	err := DbClient.Set("gorm:table_options", "ENGINE=InnoDB").AutoMigrate(&Task{})
-	if err != nil {
-		return nil, err
+		// 自动创建任务表
+		store, err := NewGormStore(options.Db)
+		if err != nil {
+			return nil, err
+		}
+		options.Store = store
 	}
 
 	return &ExportCenter{
-		Db:            options.Db,
-		Queue:         options.Queue,
-		poolMax:       options.PoolMax,
-		sheetMaxRows:  options.SheetMaxRows,
-		goroutineMax:  options.GoroutineMax,
-		isUploadCloud: options.IsUploadCloud,
-		upload:        options.Upload,
-		logRootPath:   options.LogRootPath,
-		outTime:       options.OutTime,
+		Db:               options.Db,
+		Queue:            options.Queue,
+		store:            options.Store,
+		signaler:         options.Signaler,
+		poolMax:          options.PoolMax,
+		sheetMaxRows:     options.SheetMaxRows,
+		goroutineMax:     options.GoroutineMax,
+		isUploadCloud:    options.IsUploadCloud,
+		upload:           options.Upload,
+		logRootPath:      options.LogRootPath,
+		outTime:          options.OutTime,
+		waitClose:        options.WaitClose,
+		idleTimeout:      options.IdleTimeout,
+		startTimeout:     options.StartTimeout,
+		progressInterval: options.ProgressInterval,
+		progressRows:     options.ProgressRows,
 	}, nil
 }
 
 // CreateTask 创建导出任务
+// count为UnknownCount时创建流式任务：生产者向唯一的队列推送数据，推送完成后调用CloseQueue，导出时数据表达到最大行数自动新增数据表
 func (ec *ExportCenter) CreateTask(key, name, description, source, destination, format string, count int64, options ExportOptions) (uint, []string, error) {
-	marshal, err := json.Marshal(options)
+	task, keys, err := ec.createTask(key, name, description, source, destination, format, count, options)
+	return task.ID, keys, err
+}
+
+// CreateTaskWithSheets 创建导出任务，返回各数据队列与对应的数据表名称，数据表名称按SheetNames与SheetName模板生成，分区任务为分区名称
+func (ec *ExportCenter) CreateTaskWithSheets(key, name, description, source, destination, format string, count int64, options ExportOptions) (uint, []SheetQueue, error) {
+	task, keys, err := ec.createTask(key, name, description, source, destination, format, count, options)
 	if err != nil {
 		return 0, nil, err
 	}
 
+	// 分区任务的数据表名称与预设分区对应，所有分区共用队列时名称为空
+	namer := newSheetNamer(task, options)
+	sheets := make([]SheetQueue, 0, len(keys))
+	for i, queueKey := range keys {
+		sheet := SheetQueue{Key: queueKey}
+		switch {
+		case options.PartitionBy == "":
+			sheet.Name = namer.name(i + 1)
+		case len(options.Partitions) > 0:
+			sheet.Name = namer.unique(options.Partitions[i], i+1)
+		}
+		sheets = append(sheets, sheet)
+	}
+	return task.ID, sheets, nil
+}
+
+func (ec *ExportCenter) createTask(key, name, description, source, destination, format string, count int64, options ExportOptions) (Task, []string, error) {
+	if options.PartitionBy != "" {
+		if _, err := options.partitionColumn(); err != nil {
+			return Task{}, nil, err
+		}
+	}
+
+	marshal, err := json.Marshal(options)
+	if err != nil {
+		return Task{}, nil, err
+	}
+
 	// 创建导出任务
 	task := Task{
 		Name:          name,
@@ -112,36 +220,22 @@ func (ec *ExportCenter) CreateTask(key, name, description, source, destination,
 		QueueKey:      key,
 		CountNum:      count,
 	}
-	err = task.Create()
+	err = ec.store.Create(context.Background(), &task)
 	if err != nil {
-		return 0, nil, err
+		return Task{}, nil, err
 	}
 
-	// 根据数据量，创建导出任务的数据队列
-	sheetCount := int(math.Ceil(float64(count) / float64(ec.sheetMaxRows)))
-
+	// 根据数据量，创建导出任务的数据队列，流式任务只有一个队列
 	ctx := context.Background()
-	keys := make([]string, 0)
-	for i := 1; i <= sheetCount; i++ {
-		queueKey := ""
-		if ec.queuePrefix != "" {
-			queueKey = fmt.Sprintf("%s_%s_sheet%d", ec.queuePrefix, task.QueueKey, i)
-		} else {
-			queueKey = fmt.Sprintf("%s_sheet%d", task.QueueKey, i)
-		}
-
+	keys := ec.taskQueueKeys(task)
+	for _, queueKey := range keys {
 		err = ec.Queue.CreateQueue(ctx, queueKey)
 		if err != nil {
-			return 0, nil, err
+			return Task{}, nil, err
 		}
-
-		keys = append(keys, queueKey)
 	}
 
-	// 开启任务开始信号通道
-	startSignal.Store(int64(task.ID), make(chan bool, 1))
-
-	return task.ID, keys, err
+	return task, keys, err
 }
 
 // PushData 推送导出数据到队列
@@ -150,56 +244,159 @@ func (ec *ExportCenter) PushData(key string, data string) error {
 	return ec.Queue.Push(ctx, key, data)
 }
 
+// PushBatch 批量推送数据，队列不支持批量推送时逐条推送
+func (ec *ExportCenter) PushBatch(key string, rows []string) error {
+	ctx := context.Background()
+	if queue, ok := ec.Queue.(BatchQueue); ok {
+		return queue.PushBatch(ctx, key, rows)
+	}
+	for _, row := range rows {
+		err := ec.Queue.Push(ctx, key, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseQueue 结束队列的数据流，导出协程读取到结束标记后完成该数据表，不再等待剩余数据
+// 在推送完队列的所有数据后调用，任务的所有队列都结束后任务完成
+func (ec *ExportCenter) CloseQueue(key string) error {
+	return ec.PushData(key, EndOfStream)
+}
+
 // PopData 拉取队列数据
 func (ec *ExportCenter) PopData(key string) <-chan string {
 	ctx := context.Background()
 	return ec.Queue.Pop(ctx, key)
 }
 
+// AckData 确认队列数据已处理，队列不支持确认时忽略
+func (ec *ExportCenter) AckData(key string, data string) error {
+	queue, ok := ec.Queue.(AckQueue)
+	if !ok {
+		return nil
+	}
+	ctx := context.Background()
+	return queue.Ack(ctx, key, data)
+}
+
+// RejectData 拒绝无法处理的队列数据，队列不支持拒绝时按确认处理
+func (ec *ExportCenter) RejectData(key string, data string, reason error) error {
+	queue, ok := ec.Queue.(RejectQueue)
+	if !ok {
+		return ec.AckData(key, data)
+	}
+	ctx := context.Background()
+	return queue.Reject(ctx, key, data, reason)
+}
+
 // GetTask 获取任务信息
 func (ec *ExportCenter) GetTask(id int64) (info Task, err error) {
-	task := Task{}
-	return task.FindByID(id)
+	return ec.store.Get(context.Background(), id)
 }
 
 // CompleteTask 完成任务
 func (ec *ExportCenter) CompleteTask(id, writeNum int64) error {
-	task := Task{}
-	return task.CompleteTaskByID(id, writeNum)
+	return ec.store.Complete(context.Background(), id, writeNum)
 }
 
 // ConsultTask 任务进行中
 func (ec *ExportCenter) ConsultTask(id int64) error {
-	task := Task{}
-	return task.UpdateStatusByID(id, TaskStatusConsult)
+	return ec.store.UpdateStatus(context.Background(), id, TaskStatusConsult)
 }
 
 // FailTask 任务失败
 func (ec *ExportCenter) FailTask(id int64, errNum, writeNum int64) error {
-	task := Task{}
-	return task.FailTaskByID(id, errNum, writeNum)
+	return ec.store.Fail(context.Background(), id, errNum, writeNum)
 }
 
 // UpdateTaskDownloadUrl 更新任务文件下载链接
 func (ec *ExportCenter) UpdateTaskDownloadUrl(id int64, url string) error {
-	task := Task{}
-	return task.UpdateDownloadUrlByID(id, url)
+	return ec.store.UpdateDownloadUrl(context.Background(), id, url)
 }
 
 // UpdateTaskErrLogUrl 更新错误日志地址
 func (ec *ExportCenter) UpdateTaskErrLogUrl(id int64, url string) error {
-	task := Task{}
-	return task.UpdateErrLogUrlByID(id, url)
+	return ec.store.UpdateErrLogUrl(context.Background(), id, url)
+}
+
+// UpdateTaskProgress 更新任务进度
+func (ec *ExportCenter) UpdateTaskProgress(id int64, progressRate int, writeNum, errNum int64) error {
+	return ec.store.UpdateProgress(context.Background(), id, progressRate, writeNum, errNum)
+}
+
+// UpdateTaskCount 更新任务数据总数
+func (ec *ExportCenter) UpdateTaskCount(id int64, count int64) error {
+	return ec.store.UpdateCount(context.Background(), id, count)
+}
+
+// AbandonTask 任务废弃
+func (ec *ExportCenter) AbandonTask(id int64) error {
+	return ec.store.Abandon(context.Background(), id)
 }
 
-// StartTask 开启任务
-func (ec *ExportCenter) StartTask(id int64) {
-	val, _ := startSignal.LoadOrStore(id, make(chan bool, 1))
-	val.(chan bool) <- true
+// CancelTask 取消任务，停止正在导出的协程、销毁队列、删除未完成的文件，并将任务标记为废弃
+// 等待开启信号以及正在消费数据的任务都可以取消，已结束的任务返回ErrTaskFinished
+// 在其他进程导出的任务会在下一次更新进度（ProgressInterval）时发现任务已废弃并停止
+func (ec *ExportCenter) CancelTask(id int64) error {
+	task, err := ec.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if task.isFinished() {
+		return ErrTaskFinished
+	}
+
+	if val, ok := ec.running.Load(id); ok {
+		// 通知导出协程停止，并等待清理完成
+		run := val.(*runningTask)
+		run.cancel()
+		<-run.done
+
+		// 取消前任务可能已经导出完成
+		task, err = ec.GetTask(id)
+		if err != nil {
+			return err
+		}
+		if task.isFinished() {
+			return ErrTaskFinished
+		}
+	}
+
+	// 销毁队列，任务可能没有在当前进程导出或者还未开启
+	ec.destroyQueues(task)
+	_ = ec.signaler.Clear(context.Background(), id)
+	return ec.AbandonTask(id)
+}
+
+// StartTask 开启任务，通过开启信号唤醒等待中的导出协程，导出协程可以在其他进程
+func (ec *ExportCenter) StartTask(id int64) error {
+	return ec.signaler.Notify(context.Background(), id)
 }
 
 // ExportToExcel 导出成excel表格，格式
 func (ec *ExportCenter) ExportToExcel(id int64, filePath string, before func(key string) error) (err error) {
+	return ec.export(id, filePath, FormatXlsx, before)
+}
+
+// Export 导出文件，根据任务的导出格式（Task.ExportFormat）选择写入器
+func (ec *ExportCenter) Export(id int64, filePath string, before func(key string) error) (err error) {
+	return ec.export(id, filePath, "", before)
+}
+
+// export 导出文件，format为空时使用任务的导出格式
+func (ec *ExportCenter) export(id int64, filePath, format string, before func(key string) error) (err error) {
+	// 注册正在导出的任务，用于取消任务
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &runningTask{cancel: cancel, done: make(chan struct{})}
+	ec.running.Store(id, run)
+	defer func() {
+		ec.running.Delete(id)
+		cancel()
+		close(run.done)
+	}()
+
 	// 创建日志文件
 	var log = logrus.New()
 	logPath := fmt.Sprintf("/export_log/export-system(task_id-%d).log", id)
@@ -227,28 +424,23 @@ func (ec *ExportCenter) ExportToExcel(id int64, filePath string, before func(key
 		_ = ec.UpdateTaskErrLogUrl(id, logPath)
 	}()
 
-	signal, ok := startSignal.Load(id)
-	if !ok {
-		return err
-	}
-
 	// 接收到开启信号再开启任务
-	start := false
-	for {
-		select {
-		case start = <-signal.(chan bool):
-			if start {
-				break
-			}
-		case <-time.After(60 * time.Second):
-			log.Error(fmt.Sprintf("开启任务超时，超时时间1分钟，请及时开启任务"))
-			return nil
+	waitCtx, waitCancel := context.WithTimeout(ctx, ec.startTimeout)
+	err = ec.signaler.Wait(waitCtx, id)
+	waitCancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Info("任务已取消")
+			return ErrTaskCanceled
 		}
-		if start {
-			close(signal.(chan bool))
-			break
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Error(fmt.Sprintf("开启任务超时，超时时间%s，请及时开启任务", ec.startTimeout))
+			return nil
 		}
+		log.Error(err)
+		return err
 	}
+	_ = ec.signaler.Clear(ctx, id)
 
 	// 获取任务信息
 	task, err := ec.GetTask(id)
@@ -256,241 +448,221 @@ func (ec *ExportCenter) ExportToExcel(id int64, filePath string, before func(key
 		log.Error(err)
 		return err
 	}
+	if task.isFinished() {
+		log.Error(ErrTaskFinished)
+		return ErrTaskFinished
+	}
 
-	err = ec.ConsultTask(id)
+	// 根据导出格式获取写入器
+	if format == "" {
+		format = task.ExportFormat
+	}
+	writer, err := NewWriter(format)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	// 根据数据量，创建导出任务的数据队列
-	sheetCount := int(math.Ceil(float64(task.CountNum) / float64(ec.sheetMaxRows)))
-
-	// 生成或者打开excel
-	f := excelize.NewFile()
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Error(err)
-			fmt.Println(err)
-		}
-	}()
-
-	// 流式写入器字典
-	swMap := make(map[int32]*excelize.StreamWriter, 0)
-
 	// 获取表格标题
 	options := ExportOptions{}
 	err = json.Unmarshal([]byte(task.ExportOptions), &options)
 	if err != nil {
+		log.Error(err)
 		return err
 	}
-
-	for i := 1; i <= sheetCount; i++ {
-		queueKey := ""
-		if ec.queuePrefix != "" {
-			queueKey = fmt.Sprintf("%s_%s_sheet%d", ec.queuePrefix, task.QueueKey, i)
-		} else {
-			queueKey = fmt.Sprintf("%s_sheet%d", task.QueueKey, i)
-		}
-
-		err = before(queueKey)
+	options.normalize()
+	decoder := ec.newRowDecoder(task, options)
+	namer := newSheetNamer(task, options)
+	partitionColumn := -1
+	if options.PartitionBy != "" {
+		partitionColumn, err = options.partitionColumn()
 		if err != nil {
 			log.Error(err)
 			return err
 		}
+	}
 
-		currentSheet := fmt.Sprintf("Sheet%d", i)
-
-		if i > 1 {
-			// 创建sheet
-			_, err = f.NewSheet(fmt.Sprintf("Sheet%d", i))
-			if err != nil {
-				log.Error(err)
-				return err
-			}
-		}
+	err = ec.ConsultTask(id)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
-		// 获取写入器
-		sw, err := f.NewStreamWriter(currentSheet)
-		if err != nil {
+	// 生成文件
+	err = writer.Open(filePath, options)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer func() {
+		if err := writer.Close(); err != nil {
 			log.Error(err)
-			return err
+			fmt.Println(err)
 		}
-		swMap[int32(i)] = sw
+	}()
 
-		var headers []interface{}
-		for _, s := range options.Header {
-			headers = append(headers, s)
-		}
-		// 生成标题
-		cell, _ := excelize.CoordinatesToCellName(1, 1)
-		err = sw.SetRow(cell, headers)
-		if err != nil {
-			log.Error(err)
-			return err
+	// 记录导出进度，定时更新任务的进度与已写入数据数
+	prog := newProgress(task.CountNum)
+	run.progress.Store(prog)
+	stopProgress := ec.reportProgress(id, prog, cancel, log)
+
+	// 消费队列数据写入文件
+	var completed bool
+	if partitionColumn >= 0 {
+		var pw *partitionWriter
+		pw, err = newPartitionWriter(writer, namer, partitionColumn, ec.sheetMaxRows, options.Partitions)
+		if err == nil {
+			completed, err = ec.consumePartitions(ctx, task, decoder, pw, prog, before, log)
 		}
+	} else if task.isStream() {
+		completed, err = ec.consumeStream(ctx, task, decoder, namer, writer, prog, before, log)
+	} else {
+		completed, err = ec.consumeSheets(ctx, task, decoder, namer, writer, prog, before, log)
 	}
+	stopProgress()
 
-	// 判断sheet的数据量是否达到限制，达到限制则增加数据到下一张sheet，设置当前数据增加的sheet索引值
-	count := int64(0)
-	errRowCount := int64(0)
-
-	// 创建并发工作组，在工作组中使用协程处理数据写入，单个协程会有一个小时的过期时间，一个小时内未完成单表设置的最大数量就会任务失败
-	var wg sync.WaitGroup
-	p, _ := ants.NewPoolWithFunc(ec.poolMax, func(sheetIndex interface{}) {
-		currentSheetIndex := sheetIndex.(int32)
-		queueKey := ""
-		if ec.queuePrefix != "" {
-			queueKey = fmt.Sprintf("%s_%s_sheet%d", ec.queuePrefix, task.QueueKey, currentSheetIndex)
-		} else {
-			queueKey = fmt.Sprintf("%s_sheet%d", task.QueueKey, currentSheetIndex)
+	// 任务已取消（包括在其他进程取消），删除未完成的文件，由CancelTask销毁队列并标记任务废弃
+	if ctx.Err() != nil {
+		log.Info("任务已取消")
+		if err := writer.Close(); err != nil {
+			log.Error(err)
 		}
-
-		// 设置当前首行
-		rowCount := int64(1)
-		// 拉取队列数据
-		for {
-			currentRowNum := atomic.LoadInt64(&rowCount) + 1 // 当前行
-			currentCount := atomic.LoadInt64(&count)
-
-			out := false
-			select {
-			case data := <-ec.PopData(queueKey):
-				if data == "" {
-					// 记录错误数据数
-					atomic.AddInt64(&errRowCount, 1)
-					break
-				}
-
-				var values interface{}
-				err = json.Unmarshal([]byte(data), &values)
-				if err != nil {
-					// 记录错误数据数
-					atomic.AddInt64(&errRowCount, 1)
-					log.Error(err)
-					break
-				}
-
-				cell, err := excelize.CoordinatesToCellName(1, int(currentRowNum))
-				if err != nil {
-					// 记录错误数据数
-					atomic.AddInt64(&errRowCount, 1)
-					break
-				}
-
-				slice := ec.interfaceToSlice(values)
-
-				// 写入excel文件
-				err = swMap[currentSheetIndex].SetRow(cell, slice)
-				if err != nil {
-					// 记录错误数据数
-					atomic.AddInt64(&errRowCount, 1)
-					break
-				}
-			case <-time.After(ec.outTime):
-				out = true
-				outErr := fmt.Sprintf("%d行写入数据超时", currentRowNum)
-				fmt.Println(outErr)
-				log.WithFields(logrus.Fields{
-					"currentRowNum": currentRowNum,
-					"count":         currentCount,
-				}).Error(outErr)
-				break
-			}
-
-			if out {
-				break
-			}
-
-			// 增加数据到当前sheet并记录当前数据行索引，达到限制新增sheet，并重置当前sheet索引值
-			atomic.AddInt64(&count, 1) // 记录数据进度
-			atomic.AddInt64(&rowCount, 1)
-			if currentRowNum > ec.sheetMaxRows || currentCount+1 >= task.CountNum {
-				atomic.StoreInt64(&rowCount, 0)
-				_ = swMap[currentSheetIndex].Flush()
-				break
-			}
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Error(err)
 		}
-
-		wg.Done()
-	}, ants.WithExpiryDuration(3600), ants.WithMaxBlockingTasks(ec.goroutineMax), ants.WithLogger(log))
-	defer p.Release()
-	// 提交协程任务
-	for i := 0; i < sheetCount; i++ {
-		wg.Add(1)
-		_ = p.Invoke(int32(i + 1))
+		return ErrTaskCanceled
 	}
-	wg.Wait()
 
-	// 任务进度完成（数据量达到总数包括错误数据），删除队列
-	if count >= task.CountNum {
-		err = ec.CompleteTask(id, count)
-		if err != nil {
-			log.Error(err)
-			return err
-		}
-	} else {
-		// 任务失败
+	count := atomic.LoadInt64(&prog.count)
+	errRowCount := atomic.LoadInt64(&prog.errCount)
+	if err != nil {
+		log.Error(err)
+		ec.destroyQueues(task)
 		_ = ec.FailTask(id, errRowCount, count)
+		return err
 	}
 
 	// 销毁队列
-	ctx := context.Background()
-	for i := 1; i <= sheetCount; i++ {
-		queueKey := ""
-		if ec.queuePrefix != "" {
-			queueKey = fmt.Sprintf("%s_%s_sheet%d", ec.queuePrefix, task.QueueKey, i)
-		} else {
-			queueKey = fmt.Sprintf("%s_sheet%d", task.QueueKey, i)
-		}
-		_ = ec.Queue.Destroy(ctx, queueKey)
-	}
+	ec.destroyQueues(task)
 
-	// 根据指定路径保存文件
-	if err := f.SaveAs(filePath); err != nil {
+	// 根据指定路径保存文件，部分格式会改变文件路径（如多个csv文件打包成zip），保存或上传失败时任务失败
+	url, err := ec.saveFile(writer)
+	if err != nil {
 		log.Error(err)
+		_ = ec.FailTask(id, errRowCount, count)
+		return err
+	}
+	err = ec.UpdateTaskDownloadUrl(id, url)
+	if err != nil {
+		log.Error(err)
+		_ = ec.FailTask(id, errRowCount, count)
 		return err
 	}
 
-	if ec.isUploadCloud {
-		// 将文件上传至云端，记录下载地址
-		url, err := ec.upload(filePath)
+	// 任务进度完成（数据量达到总数包括错误数据，或者所有队列都已结束），文件保存后才标记任务完成
+	if !completed {
+		// 任务失败
+		_ = ec.FailTask(id, errRowCount, count)
+		return
+	}
+	if task.isStream() {
+		// 流式任务结束后确定数据总数
+		err = ec.UpdateTaskCount(id, count)
 		if err != nil {
 			log.Error(err)
 			return err
 		}
+	}
+	err = ec.CompleteTask(id, count)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	return
+}
 
-		err = ec.UpdateTaskDownloadUrl(id, url)
-		if err != nil {
-			log.Error(err)
-			return err
-		}
+// saveFile 保存文件，开启上传时上传至云端并删除本地文件，返回文件下载地址
+func (ec *ExportCenter) saveFile(writer Writer) (string, error) {
+	filePath, err := writer.Save()
+	if err != nil {
+		return "", err
+	}
+	if !ec.isUploadCloud {
+		return filePath, nil
+	}
 
-		// 删除本地文件
-		err = os.Remove(filePath)
-		if err != nil {
-			log.Error(err)
-			return err
+	// 将文件上传至云端，记录下载地址
+	url, err := ec.upload(filePath)
+	if err != nil {
+		return "", err
+	}
+	// 删除本地文件
+	err = os.Remove(filePath)
+	if err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+// destroyQueues 销毁任务的所有数据队列
+func (ec *ExportCenter) destroyQueues(task Task) {
+	ctx := context.Background()
+	for _, queueKey := range ec.taskQueueKeys(task) {
+		_ = ec.Queue.Destroy(ctx, queueKey)
+	}
+}
+
+// taskQueueKeys 任务的所有队列key，分区任务按预设分区生成，流式任务只有一个队列，否则根据数据量计算数据表数量
+func (ec *ExportCenter) taskQueueKeys(task Task) []string {
+	options := ExportOptions{}
+	_ = json.Unmarshal([]byte(task.ExportOptions), &options)
+	if options.PartitionBy != "" {
+		if len(options.Partitions) == 0 {
+			return []string{ec.partitionQueueKey(task.QueueKey, "")}
 		}
-	} else {
-		err = ec.UpdateTaskDownloadUrl(id, filePath)
-		if err != nil {
-			log.Error(err)
-			return err
+		keys := make([]string, 0, len(options.Partitions))
+		for _, value := range options.Partitions {
+			keys = append(keys, ec.partitionQueueKey(task.QueueKey, value))
 		}
+		return keys
 	}
 
-	return
+	if task.isStream() {
+		return []string{ec.streamQueueKey(task.QueueKey)}
+	}
+
+	sheetCount := int(math.Ceil(float64(task.CountNum) / float64(ec.sheetMaxRows)))
+	keys := make([]string, 0, sheetCount)
+	for i := 1; i <= sheetCount; i++ {
+		keys = append(keys, ec.sheetQueueKey(task.QueueKey, i))
+	}
+	return keys
 }
 
-func (ec *ExportCenter) interfaceToSlice(obj interface{}) []interface{} {
-	var list []interface{}
-	if reflect.TypeOf(obj).Kind() == reflect.Slice {
-		s := reflect.ValueOf(obj)
-		for i := 0; i < s.Len(); i++ {
-			ele := s.Index(i)
-			list = append(list, ele.Interface())
-		}
+// streamQueueKey 生成流式任务的队列key
+func (ec *ExportCenter) streamQueueKey(key string) string {
+	if ec.queuePrefix != "" {
+		return fmt.Sprintf("%s_%s_stream", ec.queuePrefix, key)
+	}
+	return fmt.Sprintf("%s_stream", key)
+}
+
+// partitionQueueKey 生成分区对应的队列key，partition为空时为所有分区共用的队列
+func (ec *ExportCenter) partitionQueueKey(key, partition string) string {
+	suffix := "partition"
+	if partition != "" {
+		suffix = "partition_" + partition
+	}
+	if ec.queuePrefix != "" {
+		return fmt.Sprintf("%s_%s_%s", ec.queuePrefix, key, suffix)
+	}
+	return fmt.Sprintf("%s_%s", key, suffix)
+}
+
+// sheetQueueKey 生成数据表对应的队列key
+func (ec *ExportCenter) sheetQueueKey(key string, index int) string {
+	if ec.queuePrefix != "" {
+		return fmt.Sprintf("%s_%s_sheet%d", ec.queuePrefix, key, index)
 	}
-	return list
+	return fmt.Sprintf("%s_sheet%d", key, index)
 }
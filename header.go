@@ -0,0 +1,73 @@
+package exportcenter
+
+import (
+	"github.com/xuri/excelize/v2"
+)
+
+// HeaderNode 多级表头节点，叶子节点为数据列，分组节点在xlsx中合并为跨越其所有叶子列的单元格
+type HeaderNode struct {
+	Title    string       `json:"title"`              // 标题
+	Children []HeaderNode `json:"children,omitempty"` // 子节点
+}
+
+// headerLeaves 叶子节点的标题，即各数据列的表头
+func headerLeaves(nodes []HeaderNode, leaves []string) []string {
+	for _, node := range nodes {
+		if len(node.Children) == 0 {
+			leaves = append(leaves, node.Title)
+		} else {
+			leaves = headerLeaves(node.Children, leaves)
+		}
+	}
+	return leaves
+}
+
+// headerDepth 表头树的层数
+func headerDepth(nodes []HeaderNode) int {
+	depth := 0
+	for _, node := range nodes {
+		if d := headerDepth(node.Children) + 1; d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// headerLayout 多级表头的布局，rows为各表头行的数据，被合并的单元格为空值，merges为需要合并的单元格范围
+type headerLayout struct {
+	rows   [][]interface{}
+	merges [][2]string
+}
+
+// newHeaderLayout 生成多级表头布局，分组节点横向合并其所有叶子列，层级不足的叶子节点纵向合并到最后一行表头
+func newHeaderLayout(nodes []HeaderNode) *headerLayout {
+	depth := headerDepth(nodes)
+	cols := len(headerLeaves(nodes, nil))
+	layout := &headerLayout{rows: make([][]interface{}, depth)}
+	for i := range layout.rows {
+		layout.rows[i] = make([]interface{}, cols)
+	}
+	layout.place(nodes, 0, 0)
+	return layout
+}
+
+// place 放置同一层级的节点，返回下一个节点的起始列
+func (l *headerLayout) place(nodes []HeaderNode, level, col int) int {
+	for _, node := range nodes {
+		l.rows[level][col] = node.Title
+		start := col
+		row := level
+		if len(node.Children) == 0 {
+			row = len(l.rows) - 1
+			col++
+		} else {
+			col = l.place(node.Children, level+1, col)
+		}
+		if col-1 > start || row > level {
+			from, _ := excelize.CoordinatesToCellName(start+1, level+1)
+			to, _ := excelize.CoordinatesToCellName(col, row+1)
+			l.merges = append(l.merges, [2]string{from, to})
+		}
+	}
+	return col
+}
@@ -0,0 +1,45 @@
+package pending
+
+import "sync"
+
+// Pending 已投递未确认的消息，按数据内容索引，相同数据按投递顺序确认
+type Pending[T any] struct {
+	items map[string][]T
+	lock  sync.Mutex
+}
+
+func New[T any]() *Pending[T] {
+	return &Pending[T]{items: make(map[string][]T)}
+}
+
+// Push 记录投递的消息
+func (p *Pending[T]) Push(data string, item T) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.items[data] = append(p.items[data], item)
+}
+
+// Pop 取出数据最早投递的消息，没有时返回false
+func (p *Pending[T]) Pop(data string) (T, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	items := p.items[data]
+	if len(items) == 0 {
+		var zero T
+		return zero, false
+	}
+	if len(items) == 1 {
+		delete(p.items, data)
+	} else {
+		p.items[data] = items[1:]
+	}
+	return items[0], true
+}
+
+// Reset 清空所有消息
+func (p *Pending[T]) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.items = make(map[string][]T)
+}
@@ -0,0 +1,118 @@
+package exportcenter
+
+import (
+	"bufio"
+	"github.com/goccy/go-json"
+	"os"
+	"sync"
+)
+
+// jsonlWriter JSON Lines写入器，每行数据为一个json对象，键为表头，未配置表头时写入json数组
+type jsonlWriter struct {
+	file     *os.File
+	filePath string
+	writer   *bufio.Writer
+	keys     [][]byte
+	lock     sync.Mutex
+}
+
+func (w *jsonlWriter) Open(filePath string, options ExportOptions) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.filePath = filePath
+	w.writer = bufio.NewWriter(file)
+	for _, s := range options.Header {
+		key, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		w.keys = append(w.keys, key)
+	}
+	return nil
+}
+
+func (w *jsonlWriter) NewSheet(name string) (SheetWriter, error) {
+	return &jsonlSheet{w: w}, nil
+}
+
+func (w *jsonlWriter) Save() (string, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.writer.Flush(); err != nil {
+		return "", err
+	}
+	err := w.file.Close()
+	w.file = nil
+	return w.filePath, err
+}
+
+func (w *jsonlWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// jsonlSheet JSON Lines数据表，多个数据表共享同一个写入器
+type jsonlSheet struct {
+	w    *jsonlWriter
+	line []byte
+}
+
+func (s *jsonlSheet) WriteRow(values []interface{}) error {
+	line, err := s.encode(values)
+	if err != nil {
+		return err
+	}
+
+	s.w.lock.Lock()
+	defer s.w.lock.Unlock()
+	_, err = s.w.writer.Write(line)
+	return err
+}
+
+// encode 按表头顺序生成json对象，保证字段顺序与表头一致
+func (s *jsonlSheet) encode(values []interface{}) ([]byte, error) {
+	if len(s.w.keys) == 0 {
+		line, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	}
+
+	s.line = append(s.line[:0], '{')
+	for i, key := range s.w.keys {
+		if i > 0 {
+			s.line = append(s.line, ',')
+		}
+		var value interface{}
+		if i < len(values) {
+			value = values[i]
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		s.line = append(s.line, key...)
+		s.line = append(s.line, ':')
+		s.line = append(s.line, v...)
+	}
+	s.line = append(s.line, '}', '\n')
+	return s.line, nil
+}
+
+func (s *jsonlSheet) Flush() error {
+	s.w.lock.Lock()
+	defer s.w.lock.Unlock()
+	return s.w.writer.Flush()
+}
@@ -0,0 +1,125 @@
+package memqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueNotFound 队列不存在或已销毁
+var ErrQueueNotFound = errors.New("memqueue: queue not found")
+
+// DefaultCapacity 默认队列容量
+const DefaultCapacity = 10000
+
+// MemQueue 基于channel的内存队列，适用于单元测试以及没有消息中间件的单进程部署
+type MemQueue struct {
+	capacity int
+	queues   map[string]*queue
+	lock     sync.RWMutex
+}
+
+type Options struct {
+	Capacity int // 单个队列容量，队列满时Push会阻塞，默认10000
+}
+
+// queue 单个队列，done关闭后不再接收数据
+type queue struct {
+	data chan string
+	done chan struct{}
+	lock sync.RWMutex
+}
+
+func New(options Options) *MemQueue {
+	if options.Capacity <= 0 {
+		options.Capacity = DefaultCapacity
+	}
+	return &MemQueue{
+		capacity: options.Capacity,
+		queues:   make(map[string]*queue),
+	}
+}
+
+// CreateQueue 创建队列，队列已存在时不做处理
+func (m *MemQueue) CreateQueue(ctx context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.queues[key]; !ok {
+		m.queues[key] = &queue{
+			data: make(chan string, m.capacity),
+			done: make(chan struct{}),
+		}
+	}
+	return nil
+}
+
+// Push 推送数据，队列已满时阻塞直到有空间、ctx结束或队列被销毁
+func (m *MemQueue) Push(ctx context.Context, key, data string) error {
+	q := m.get(key)
+	if q == nil {
+		return ErrQueueNotFound
+	}
+
+	// 持有读锁，保证销毁队列时不会向已关闭的channel发送数据
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	select {
+	case <-q.done:
+		return ErrQueueNotFound
+	default:
+	}
+
+	select {
+	case q.data <- data:
+		return nil
+	case <-q.done:
+		return ErrQueueNotFound
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pop 获取队列的数据通道，多次调用返回同一个通道，没有数据时读取会阻塞，队列销毁后通道关闭
+// 队列不存在时返回nil通道，读取会一直阻塞
+func (m *MemQueue) Pop(ctx context.Context, key string) <-chan string {
+	q := m.get(key)
+	if q == nil {
+		return nil
+	}
+	return q.data
+}
+
+// Len 队列中待消费的数据数量
+func (m *MemQueue) Len(key string) int {
+	q := m.get(key)
+	if q == nil {
+		return 0
+	}
+	return len(q.data)
+}
+
+// Destroy 销毁队列，未消费的数据会被丢弃
+func (m *MemQueue) Destroy(ctx context.Context, key string) error {
+	m.lock.Lock()
+	q, ok := m.queues[key]
+	delete(m.queues, key)
+	m.lock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// 先通知阻塞中的Push退出，再关闭数据通道
+	close(q.done)
+	q.lock.Lock()
+	close(q.data)
+	q.lock.Unlock()
+	return nil
+}
+
+func (m *MemQueue) get(key string) *queue {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.queues[key]
+}
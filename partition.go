@@ -0,0 +1,145 @@
+package exportcenter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// partitionWriter 分区写入器，按分区列的值将数据行写入同名数据表，超过最大行数时新增数据表，如华东 (2)
+// 多个队列的消费协程并发写入，实现SheetWriter接口
+type partitionWriter struct {
+	writer     Writer
+	namer      *sheetNamer
+	column     int
+	maxRows    int64
+	sheets     int // 已创建的数据表数量
+	partitions map[string]*partition
+	lock       sync.Mutex
+}
+
+// partition 分区当前写入的数据表
+type partition struct {
+	name string // 分区的数据表名称，新增的数据表在该名称后增加序号
+	sw   SheetWriter
+	rows int64
+	lock sync.Mutex
+}
+
+// partitionColumn 分区列的索引，按对象数据行的字段名或表头查找，同时校验预设分区
+func (o ExportOptions) partitionColumn() (int, error) {
+	o.normalize()
+	seen := make(map[string]struct{}, len(o.Partitions))
+	for _, value := range o.Partitions {
+		if value == "" {
+			return 0, errors.New("预设分区不能为空")
+		}
+		if _, ok := seen[value]; ok {
+			return 0, fmt.Errorf("预设分区重复：%s", value)
+		}
+		seen[value] = struct{}{}
+	}
+
+	for _, names := range [][]string{o.columnKeys(), o.Header} {
+		for i, name := range names {
+			if name == o.PartitionBy {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("分区列不存在：%s", o.PartitionBy)
+}
+
+// newPartitionWriter 创建分区写入器，按顺序为预设分区创建数据表，未收到数据的预设分区只有表头
+func newPartitionWriter(writer Writer, namer *sheetNamer, column int, maxRows int64, partitions []string) (*partitionWriter, error) {
+	w := &partitionWriter{
+		writer:     writer,
+		namer:      namer,
+		column:     column,
+		maxRows:    maxRows,
+		partitions: make(map[string]*partition, len(partitions)),
+	}
+	for _, value := range partitions {
+		if _, err := w.partition(value); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *partitionWriter) WriteRow(values []interface{}) error {
+	value := ""
+	if w.column < len(values) {
+		value = cellString(values[w.column])
+	}
+	p, err := w.partition(value)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.rows >= w.maxRows {
+		// 达到数据表最大行数，分区新增数据表
+		if err = p.sw.Flush(); err != nil {
+			return err
+		}
+		if p.sw, err = w.newSheet(p.name); err != nil {
+			return err
+		}
+		p.rows = 0
+	}
+	if err = p.sw.WriteRow(values); err != nil {
+		return err
+	}
+	p.rows++
+	return nil
+}
+
+// Flush 写入所有分区的数据表，先复制分区列表并释放写入器的锁，与WriteRow保持先分区后写入器的加锁顺序
+func (w *partitionWriter) Flush() error {
+	w.lock.Lock()
+	partitions := make([]*partition, 0, len(w.partitions))
+	for _, p := range w.partitions {
+		partitions = append(partitions, p)
+	}
+	w.lock.Unlock()
+
+	var err error
+	for _, p := range partitions {
+		p.lock.Lock()
+		if e := p.sw.Flush(); e != nil && err == nil {
+			err = e
+		}
+		p.lock.Unlock()
+	}
+	return err
+}
+
+// partition 获取分区，首次写入时创建数据表，分区值为空时数据表名称为Sheet{序号}
+func (w *partitionWriter) partition(value string) (*partition, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if p, ok := w.partitions[value]; ok {
+		return p, nil
+	}
+	w.sheets++
+	name := w.namer.unique(value, w.sheets)
+	sw, err := w.writer.NewSheet(name)
+	if err != nil {
+		return nil, err
+	}
+	p := &partition{name: name, sw: sw}
+	w.partitions[value] = p
+	return p, nil
+}
+
+// newSheet 分区新增数据表，名称在分区数据表名称后增加序号
+func (w *partitionWriter) newSheet(name string) (SheetWriter, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.sheets++
+	return w.writer.NewSheet(w.namer.unique(name, w.sheets))
+}
@@ -0,0 +1,185 @@
+package exportcenter
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"sync/atomic"
+	"time"
+)
+
+// Progress 任务进度
+type Progress struct {
+	TaskID       int64         `json:"task_id"`
+	Status       TaskStatus    `json:"status"`        // 任务状态
+	CountNum     int64         `json:"count_num"`     // 数据总数
+	WriteNum     int64         `json:"write_num"`     // 已写入数据数（不包括错误数据）
+	ErrNum       int64         `json:"err_num"`       // 错误数据数
+	ProgressRate int           `json:"progress_rate"` // 任务进度0-100
+	Throughput   float64       `json:"throughput"`    // 写入速度，行/秒
+	Eta          time.Duration `json:"eta"`           // 预计剩余时间，无法估算时为0
+}
+
+// progress 正在导出任务的实时进度，计数器由写入协程原子更新
+type progress struct {
+	total     int64
+	count     int64 // 已处理数据数（包括错误数据）
+	errCount  int64 // 错误数据数
+	startTime time.Time
+	notify    chan struct{} // 达到行数间隔时通知立即更新进度
+}
+
+func newProgress(total int64) *progress {
+	return &progress{
+		total:     total,
+		startTime: time.Now(),
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// rate 进度百分比，导出完成前最多为99，完成时由CompleteTask更新为100
+func (p *progress) rate() int {
+	if p.total <= 0 {
+		return 0
+	}
+	rate := int(atomic.LoadInt64(&p.count) * 100 / p.total)
+	if rate > 99 {
+		rate = 99
+	}
+	return rate
+}
+
+// snapshot 生成进度信息
+func (p *progress) snapshot() Progress {
+	count := atomic.LoadInt64(&p.count)
+	errCount := atomic.LoadInt64(&p.errCount)
+	info := Progress{
+		CountNum:     p.total,
+		WriteNum:     count - errCount,
+		ErrNum:       errCount,
+		ProgressRate: p.rate(),
+	}
+	info.Throughput, info.Eta = estimate(count, p.total, time.Since(p.startTime))
+	return info
+}
+
+// estimate 根据已处理数据数以及耗时估算写入速度和剩余时间
+func estimate(count, total int64, elapsed time.Duration) (throughput float64, eta time.Duration) {
+	if count <= 0 || elapsed <= 0 {
+		return 0, 0
+	}
+	throughput = float64(count) / elapsed.Seconds()
+	if remain := total - count; remain > 0 {
+		eta = time.Duration(float64(remain) / throughput * float64(time.Second))
+	}
+	return
+}
+
+// reportProgress 定时或者每写入指定行数更新任务进度，返回的stop函数会等待最后一次更新完成
+// 任务在其他进程被取消（已结束）时调用cancel停止导出，进度没有变化时每个时间间隔查询一次任务状态
+func (ec *ExportCenter) reportProgress(id int64, p *progress, cancel context.CancelFunc, log *logrus.Logger) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		ticker := time.NewTicker(ec.progressInterval)
+		defer ticker.Stop()
+
+		last := int64(0)
+		for {
+			stopped, tick := false, false
+			select {
+			case <-done:
+				// 停止前保存最后的进度
+				stopped = true
+			case <-ticker.C:
+				tick = true
+			case <-p.notify:
+			}
+
+			var err error
+			count := atomic.LoadInt64(&p.count)
+			if count != last {
+				last = count
+				err = ec.UpdateTaskProgress(id, p.rate(), count, atomic.LoadInt64(&p.errCount))
+			} else if tick {
+				var task Task
+				if task, err = ec.GetTask(id); err == nil && task.isFinished() {
+					err = ErrTaskFinished
+				}
+			}
+			if errors.Is(err, ErrTaskFinished) {
+				if !stopped {
+					log.Info("任务已在其他进程结束，停止导出")
+					cancel()
+				}
+			} else if err != nil {
+				log.Error(err)
+			}
+
+			if stopped {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// addProgress 记录已处理的数据行数，跨过行数间隔时通知更新进度
+func (ec *ExportCenter) addProgress(p *progress, rows, failed int64) {
+	if failed > 0 {
+		atomic.AddInt64(&p.errCount, failed)
+	}
+	count := atomic.AddInt64(&p.count, rows)
+	if ec.progressRows > 0 && count/ec.progressRows != (count-rows)/ec.progressRows {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Progress 获取任务进度，正在当前进程导出的任务返回实时进度，否则根据任务记录计算
+func (ec *ExportCenter) Progress(id int64) (Progress, error) {
+	task, err := ec.GetTask(id)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	var prog *progress
+	if val, ok := ec.running.Load(id); ok {
+		prog = val.(*runningTask).progress.Load()
+	}
+
+	var info Progress
+	if prog != nil {
+		info = prog.snapshot()
+	} else {
+		info = Progress{
+			CountNum:     task.CountNum,
+			WriteNum:     task.WriteNum - task.ErrNum,
+			ErrNum:       task.ErrNum,
+			ProgressRate: task.ProgressRate,
+		}
+		if task.StartTime.Valid {
+			end := time.Now()
+			if task.EndTime.Valid {
+				end = task.EndTime.Time
+			}
+			info.Throughput, info.Eta = estimate(task.WriteNum, task.CountNum, end.Sub(task.StartTime.Time))
+			if task.isFinished() {
+				info.Eta = 0
+			}
+		}
+	}
+
+	info.TaskID = id
+	info.Status = TaskStatus(task.Status)
+	return info, nil
+}
@@ -0,0 +1,254 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DanPlayer/exportcenter/internal/pending"
+	"github.com/streadway/amqp"
+)
+
+// consumer 队列消费者，使用独立的通道，投递的消息在Ack之前保持未确认状态
+type consumer struct {
+	key     string
+	queue   string
+	tag     string
+	list    chan string // 消费协程退出后关闭
+	stop    chan struct{}
+	done    chan struct{} // 消费协程退出后关闭
+	channel *amqp.Channel
+	pending *pending.Pending[amqp.Delivery] // 已投递未确认的消息
+	lock    sync.Mutex
+	once    sync.Once
+}
+
+// DeclareConsume 声明队列的消费者，Pop会自动声明，重复声明时忽略
+func (r *RabbitMQ) DeclareConsume(key string) error {
+	r.declareConsume(context.Background(), key)
+	return nil
+}
+
+func (r *RabbitMQ) declareConsume(ctx context.Context, key string) *consumer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if c, ok := r.consumers[key]; ok {
+		return c
+	}
+
+	c := &consumer{
+		key:     key,
+		queue:   fmt.Sprintf("%s-queue", key),
+		tag:     fmt.Sprintf("%s-consumer", key),
+		list:    make(chan string),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		pending: pending.New[amqp.Delivery](),
+	}
+	r.consumers[key] = c
+	go r.consume(ctx, c)
+	return c
+}
+
+// Pop 获取队列的数据通道，首次拉取时自动声明消费者，多次调用返回同一个通道，队列销毁后通道关闭
+func (r *RabbitMQ) Pop(ctx context.Context, key string) <-chan string {
+	return r.declareConsume(ctx, key).list
+}
+
+// Ack 确认消息已处理
+func (r *RabbitMQ) Ack(ctx context.Context, key, data string) error {
+	r.lock.Lock()
+	c, ok := r.consumers[key]
+	r.lock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	delivery, ok := c.pending.Pop(data)
+	if !ok {
+		return nil
+	}
+	return delivery.Ack(false)
+}
+
+// Reject 拒绝无法处理的消息，开启DeadLetter时转入死信队列并在消息头记录拒绝原因，否则丢弃
+func (r *RabbitMQ) Reject(ctx context.Context, key, data string, reason error) error {
+	r.lock.Lock()
+	c, ok := r.consumers[key]
+	r.lock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	delivery, ok := c.pending.Pop(data)
+	if !ok {
+		return nil
+	}
+	if !r.options.DeadLetter {
+		return delivery.Nack(false, false)
+	}
+
+	exchange, _, bindKey := deadLetterNames(key)
+	err := r.withChannel(func(channel amqpChannel) error {
+		return channel.Publish(
+			exchange,
+			bindKey,
+			false,
+			false,
+			amqp.Publishing{
+				ContentType: delivery.ContentType,
+				Headers:     amqp.Table{ErrorReasonHeader: reason.Error()},
+				Body:        delivery.Body,
+			})
+	})
+	if err != nil {
+		// 转入死信队列失败，由服务端按队列的死信配置转入
+		_ = delivery.Nack(false, false)
+		return err
+	}
+	return delivery.Ack(false)
+}
+
+// consume 消费协程，通道或连接断开后按指数退避重新订阅，消费者停止或ctx结束时退出并关闭数据通道
+func (r *RabbitMQ) consume(ctx context.Context, c *consumer) {
+	defer func() {
+		r.removeConsumer(c)
+		close(c.list)
+		close(c.done)
+	}()
+
+	delay := r.options.ReconnectDelay
+	for {
+		deliveries, err := r.subscribe(c)
+		if err == nil {
+			delay = r.options.ReconnectDelay
+			if !c.forward(ctx, deliveries) {
+				return
+			}
+			// 通道断开，未确认的消息由服务端重新投递
+			c.reset()
+		}
+
+		select {
+		case <-c.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = r.backoff(delay)
+	}
+}
+
+// removeConsumer 消费协程退出时移除消费者，下次拉取时重新声明
+func (r *RabbitMQ) removeConsumer(c *consumer) {
+	r.lock.Lock()
+	if r.consumers[c.key] == c {
+		delete(r.consumers, c.key)
+	}
+	r.lock.Unlock()
+	c.close()
+}
+
+// subscribe 为消费者打开独立的通道并订阅队列，关闭自动应答
+func (r *RabbitMQ) subscribe(c *consumer) (<-chan amqp.Delivery, error) {
+	conn, err := r.connection()
+	if err != nil {
+		return nil, err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	// 限制未确认消息数量，避免消息全部推送到内存
+	err = channel.Qos(r.options.Prefetch, 0, false)
+	if err != nil {
+		_ = channel.Close()
+		return nil, err
+	}
+
+	deliveries, err := channel.Consume(
+		c.queue, // queue
+		// 用来区分多个消费者
+		c.tag, // consumer
+		// 是否自动应答，写入数据后手动应答，异常退出时未应答的消息重新投递
+		false, // auto-ack
+		// 是否独有
+		false, // exclusive
+		// 设置为true，表示 不能将同一个Conenction中生产者发送的消息传递给这个Connection中 的消费者
+		false, // no-local
+		// 列是否阻塞
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		_ = channel.Close()
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.stop:
+		// 订阅期间消费者已停止
+		_ = channel.Close()
+		return nil, ErrNotConnected
+	default:
+	}
+	c.channel = channel
+	return deliveries, nil
+}
+
+// forward 转发投递的消息到消费者通道，投递通道关闭时返回true，消费者停止或ctx结束时返回false
+func (c *consumer) forward(ctx context.Context, deliveries <-chan amqp.Delivery) bool {
+	for delivery := range deliveries {
+		data := string(delivery.Body)
+		if data == "" {
+			_ = delivery.Ack(false)
+			continue
+		}
+
+		c.pending.Push(data, delivery)
+		select {
+		case c.list <- data:
+		case <-c.stop:
+			// 通道已关闭，未确认的消息由服务端重新入队
+			return false
+		case <-ctx.Done():
+			// 消息重新入队，由其他消费者处理
+			c.pending.Pop(data)
+			_ = delivery.Nack(false, true)
+			return false
+		}
+	}
+
+	select {
+	case <-c.stop:
+		return false
+	default:
+		return true
+	}
+}
+
+// close 停止消费者并关闭通道，未确认的消息由服务端重新投递
+func (c *consumer) close() {
+	c.once.Do(func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		close(c.stop)
+		if c.channel != nil {
+			_ = c.channel.Close()
+		}
+	})
+}
+
+// reset 通道断开后清空未确认的消息，旧通道的投递无法再确认
+func (c *consumer) reset() {
+	c.lock.Lock()
+	c.channel = nil
+	c.lock.Unlock()
+	c.pending.Reset()
+}
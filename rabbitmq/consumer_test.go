@@ -0,0 +1,245 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DanPlayer/exportcenter/internal/pending"
+	"github.com/streadway/amqp"
+)
+
+// newTestRabbitMQ 创建未连接的实例，只用于测试消费者与通道池的逻辑
+func newTestRabbitMQ(options Options) *RabbitMQ {
+	if options.ReconnectDelay <= 0 {
+		options.ReconnectDelay = 10 * time.Millisecond
+	}
+	if options.ReconnectMaxDelay <= 0 {
+		options.ReconnectMaxDelay = 40 * time.Millisecond
+	}
+	if options.PoolSize <= 0 {
+		options.PoolSize = 2
+	}
+	r := &RabbitMQ{
+		options:    options,
+		publishers: make(chan amqpChannel, options.PoolSize),
+		consumers:  make(map[string]*consumer),
+		closed:     make(chan struct{}),
+	}
+	r.open = r.openChannel
+	return r
+}
+
+// fakeAcknowledger 记录消息的确认结果
+type fakeAcknowledger struct {
+	acked   []uint64
+	nacked  []uint64
+	requeue []bool
+	lock    sync.Mutex
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.acked = append(a.acked, tag)
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.nacked = append(a.nacked, tag)
+	a.requeue = append(a.requeue, requeue)
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// newTestConsumer 创建未订阅的消费者并登记到实例
+func newTestConsumer(r *RabbitMQ, key string) *consumer {
+	c := &consumer{
+		key:     key,
+		list:    make(chan string, 10),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		pending: pending.New[amqp.Delivery](),
+	}
+	r.consumers[key] = c
+	return c
+}
+
+func newDelivery(acknowledger amqp.Acknowledger, tag uint64, data string) amqp.Delivery {
+	return amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: tag, Body: []byte(data)}
+}
+
+func TestDestroyClosesConsumer(t *testing.T) {
+	r := newTestRabbitMQ(Options{})
+
+	// 连接断开时消费协程按退避重试订阅，销毁队列后退出并关闭数据通道
+	list := r.Pop(context.Background(), "test")
+	time.Sleep(50 * time.Millisecond)
+	if err := r.Destroy(context.Background(), "test"); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("destroy without connection: %v", err)
+	}
+	select {
+	case data, ok := <-list:
+		if ok {
+			t.Fatalf("destroyed queue delivered %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel of destroyed queue was not closed")
+	}
+
+	// 重新拉取时声明新的消费者
+	if r.Pop(context.Background(), "test") == list {
+		t.Fatal("destroyed queue reused the old channel")
+	}
+	_ = r.Destroy(context.Background(), "test")
+}
+
+func TestForward(t *testing.T) {
+	acknowledger := &fakeAcknowledger{}
+	c := newTestConsumer(newTestRabbitMQ(Options{}), "test")
+
+	// 空消息直接确认，其他消息转发到数据通道并等待确认，投递通道关闭后返回true
+	deliveries := make(chan amqp.Delivery, 3)
+	deliveries <- newDelivery(acknowledger, 1, "")
+	deliveries <- newDelivery(acknowledger, 2, "a")
+	deliveries <- newDelivery(acknowledger, 3, "b")
+	close(deliveries)
+	if !c.forward(context.Background(), deliveries) {
+		t.Fatal("forward returned false after deliveries closed")
+	}
+	for _, want := range []string{"a", "b"} {
+		if got := <-c.list; got != want {
+			t.Fatalf("forward: got %q, want %q", got, want)
+		}
+	}
+	if !reflect.DeepEqual(acknowledger.acked, []uint64{1}) {
+		t.Fatalf("unexpected acked tags: %v", acknowledger.acked)
+	}
+	for _, data := range []string{"a", "b"} {
+		if _, ok := c.pending.Pop(data); !ok {
+			t.Fatalf("delivery %q is not pending", data)
+		}
+	}
+}
+
+func TestForwardStop(t *testing.T) {
+	// ctx结束时未转发的消息重新入队
+	acknowledger := &fakeAcknowledger{}
+	c := newTestConsumer(newTestRabbitMQ(Options{}), "test")
+	c.list = make(chan string)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deliveries := make(chan amqp.Delivery, 1)
+	deliveries <- newDelivery(acknowledger, 1, "a")
+	if c.forward(ctx, deliveries) {
+		t.Fatal("forward returned true after ctx done")
+	}
+	if !reflect.DeepEqual(acknowledger.nacked, []uint64{1}) || !acknowledger.requeue[0] {
+		t.Fatalf("delivery was not requeued: %v %v", acknowledger.nacked, acknowledger.requeue)
+	}
+	if _, ok := c.pending.Pop("a"); ok {
+		t.Fatal("requeued delivery is still pending")
+	}
+
+	// 消费者停止时返回false，未确认的消息由服务端重新入队
+	c.close()
+	deliveries <- newDelivery(acknowledger, 2, "b")
+	if c.forward(context.Background(), deliveries) {
+		t.Fatal("forward returned true after consumer stopped")
+	}
+}
+
+func TestReset(t *testing.T) {
+	acknowledger := &fakeAcknowledger{}
+	r := newTestRabbitMQ(Options{})
+	c := newTestConsumer(r, "test")
+	c.pending.Push("a", newDelivery(acknowledger, 1, "a"))
+
+	// 通道断开后旧通道的投递无法确认，Ack忽略
+	c.reset()
+	if err := r.Ack(context.Background(), "test", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(acknowledger.acked) != 0 {
+		t.Fatalf("delivery of closed channel was acked: %v", acknowledger.acked)
+	}
+}
+
+func TestAckOrder(t *testing.T) {
+	acknowledger := &fakeAcknowledger{}
+	r := newTestRabbitMQ(Options{})
+	c := newTestConsumer(r, "test")
+	c.pending.Push("a", newDelivery(acknowledger, 1, "a"))
+	c.pending.Push("b", newDelivery(acknowledger, 2, "b"))
+	c.pending.Push("a", newDelivery(acknowledger, 3, "a"))
+
+	// 相同数据按投递顺序确认
+	for _, data := range []string{"a", "a", "b", "a"} {
+		if err := r.Ack(context.Background(), "test", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(acknowledger.acked, []uint64{1, 3, 2}) {
+		t.Fatalf("unexpected acked tags: %v", acknowledger.acked)
+	}
+}
+
+func TestRejectDeadLetter(t *testing.T) {
+	acknowledger := &fakeAcknowledger{}
+	r := newTestRabbitMQ(Options{DeadLetter: true})
+	channels := fakeOpen(r)
+	c := newTestConsumer(r, "test")
+	c.pending.Push("a", newDelivery(acknowledger, 1, "a"))
+
+	// 转入死信交换机并在消息头记录拒绝原因，发布成功后确认原消息
+	if err := r.Reject(context.Background(), "test", "a", errors.New("bad row")); err != nil {
+		t.Fatal(err)
+	}
+	channel := (*channels)[0]
+	if len(channel.published) != 1 || channel.exchanges[0] != "test-dead-exchange" {
+		t.Fatalf("row was not published to dead letter exchange: %v", channel.exchanges)
+	}
+	if msg := channel.published[0]; string(msg.Body) != "a" || msg.Headers[ErrorReasonHeader] != "bad row" {
+		t.Fatalf("unexpected dead letter: body=%q headers=%v", msg.Body, msg.Headers)
+	}
+	if !reflect.DeepEqual(acknowledger.acked, []uint64{1}) || len(acknowledger.nacked) != 0 {
+		t.Fatalf("rejected row was not acked: acked=%v nacked=%v", acknowledger.acked, acknowledger.nacked)
+	}
+
+	// 发布失败时丢弃原消息，由服务端按队列的死信配置转入
+	channel.err = errors.New("publish failed")
+	c.pending.Push("b", newDelivery(acknowledger, 2, "b"))
+	if err := r.Reject(context.Background(), "test", "b", errors.New("bad row")); !errors.Is(err, channel.err) {
+		t.Fatalf("reject: got %v, want %v", err, channel.err)
+	}
+	if !reflect.DeepEqual(acknowledger.nacked, []uint64{2}) || acknowledger.requeue[0] {
+		t.Fatalf("row was not nacked: nacked=%v requeue=%v", acknowledger.nacked, acknowledger.requeue)
+	}
+}
+
+func TestRejectWithoutDeadLetter(t *testing.T) {
+	acknowledger := &fakeAcknowledger{}
+	r := newTestRabbitMQ(Options{})
+	channels := fakeOpen(r)
+	c := newTestConsumer(r, "test")
+	c.pending.Push("a", newDelivery(acknowledger, 1, "a"))
+
+	// 未开启死信时直接丢弃，不重新入队
+	if err := r.Reject(context.Background(), "test", "a", errors.New("bad row")); err != nil {
+		t.Fatal(err)
+	}
+	if len(*channels) != 0 {
+		t.Fatal("row was published without dead letter")
+	}
+	if !reflect.DeepEqual(acknowledger.nacked, []uint64{1}) || acknowledger.requeue[0] || len(acknowledger.acked) != 0 {
+		t.Fatalf("row was not nacked: acked=%v nacked=%v requeue=%v", acknowledger.acked, acknowledger.nacked, acknowledger.requeue)
+	}
+}
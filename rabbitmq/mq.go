@@ -2,208 +2,389 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"sync"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 )
 
-var options = Options{
-	UserName: "guest",
-	Password: "guest",
-	Host:     "127.0.0.1",
-	Vhost:    "/",
-}
-
-// Client 测试案例使用的客户端，请自定义
-var Client = NewRabbitMQ(options)
+// ErrNotConnected 连接断开，正在重连
+var ErrNotConnected = errors.New("rabbitmq连接已断开")
 
-// RabbitMQ rabbitMQ结构体
+// RabbitMQ rabbitMQ结构体，连接断开后自动重连，发布使用通道池，每个消费者使用独立的通道
 type RabbitMQ struct {
-	conn     *amqp.Connection
-	channel  *amqp.Channel
-	consumer map[string]<-chan amqp.Delivery
+	options    Options
+	conn       *amqp.Connection
+	connLock   sync.RWMutex
+	publishers chan amqpChannel            // 发布通道池，amqp通道不能并发发布
+	open       func() (amqpChannel, error) // 打开新的发布通道，默认从当前连接打开
+	consumers  map[string]*consumer
+	lock       sync.Mutex
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+// amqpChannel 发布通道池使用的通道操作，由*amqp.Channel实现
+type amqpChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDelete(name string, ifUnused, noWait bool) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
 }
 
 type Options struct {
-	UserName string
-	Password string
-	Host     string
-	Vhost    string
+	UserName          string
+	Password          string
+	Host              string
+	Vhost             string
+	Prefetch          int                // 每个消费者未确认消息的最大数量，默认100
+	PoolSize          int                // 发布通道池大小，默认10
+	ReconnectDelay    time.Duration      // 重连初始等待时间，每次失败后翻倍，默认1秒
+	ReconnectMaxDelay time.Duration      // 重连最大等待时间，默认30秒
+	DeadLetter        bool               // 创建队列时同时创建死信交换机与死信队列，拒绝的数据转入死信队列，队列销毁后保留
+	Logger            logrus.FieldLogger // 记录连接断开与重连失败，默认不输出
 }
 
-// NewRabbitMQ 创建简单模式下RabbitMQ实例
-func NewRabbitMQ(options Options) *RabbitMQ {
+// ErrorReasonHeader 死信消息中记录拒绝原因的消息头
+const ErrorReasonHeader = "x-error-reason"
+
+// NewRabbitMQ 创建简单模式下RabbitMQ实例，连接失败时返回错误
+func NewRabbitMQ(options Options) (*RabbitMQ, error) {
+	if options.Prefetch <= 0 {
+		options.Prefetch = 100
+	}
+	if options.PoolSize <= 0 {
+		options.PoolSize = 10
+	}
+	if options.ReconnectDelay <= 0 {
+		options.ReconnectDelay = time.Second
+	}
+	if options.ReconnectMaxDelay <= 0 {
+		options.ReconnectMaxDelay = 30 * time.Second
+	}
+	if options.Logger == nil {
+		logger := logrus.New()
+		logger.SetOutput(io.Discard)
+		options.Logger = logger
+	}
+
 	// 创建RabbitMQ实例
-	rabbitmq := &RabbitMQ{}
-	var err error
+	rabbitmq := &RabbitMQ{
+		options:    options,
+		publishers: make(chan amqpChannel, options.PoolSize),
+		consumers:  make(map[string]*consumer, 10),
+		closed:     make(chan struct{}),
+	}
+	rabbitmq.open = rabbitmq.openChannel
 	// 获取connection
-	rabbitmq.conn, err = amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:5672/%s", options.UserName, options.Password, options.Host, options.Vhost))
-	rabbitmq.failOnErr(err, "failed to connect rabbitmq!")
-	// 获取channel
-	rabbitmq.channel, err = rabbitmq.conn.Channel()
-	rabbitmq.failOnErr(err, "failed to open a channel")
-
-	rabbitmq.consumer = make(map[string]<-chan amqp.Delivery, 10)
+	conn, closes, err := rabbitmq.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect rabbitmq: %w", err)
+	}
+	rabbitmq.conn = conn
+	go rabbitmq.watch(closes)
 
-	return rabbitmq
+	return rabbitmq, nil
 }
 
-// CreateQueue 创建队列
+// CreateQueue 创建队列，开启DeadLetter时同时创建死信交换机与死信队列
 func (r *RabbitMQ) CreateQueue(ctx context.Context, key string) error {
 	exchange := fmt.Sprintf("%s-exchange", key)
 	queue := fmt.Sprintf("%s-queue", key)
 	bindKey := fmt.Sprintf("%s-bindkey", key)
 
-	// 申请交换机
-	err := r.channel.ExchangeDeclare(
-		exchange,
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		fmt.Println(err)
-		return err
+	var args amqp.Table
+	if r.options.DeadLetter {
+		deadExchange, deadQueue, deadBindKey := deadLetterNames(key)
+		err := r.declare(deadExchange, deadQueue, deadBindKey, nil)
+		if err != nil {
+			return err
+		}
+		// 服务端拒绝或过期的消息同样转入死信队列
+		args = amqp.Table{
+			"x-dead-letter-exchange":    deadExchange,
+			"x-dead-letter-routing-key": deadBindKey,
+		}
 	}
+	return r.declare(exchange, queue, bindKey, args)
+}
 
-	// 申请队列
-	q, err := r.channel.QueueDeclare(
-		queue,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+// declare 申请交换机与队列并绑定
+func (r *RabbitMQ) declare(exchange, queue, bindKey string, args amqp.Table) error {
+	return r.withChannel(func(channel amqpChannel) error {
+		// 申请交换机
+		err := channel.ExchangeDeclare(
+			exchange,
+			"direct",
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+
+		// 申请队列
+		q, err := channel.QueueDeclare(
+			queue,
+			true,
+			false,
+			false,
+			false,
+			args,
+		)
+		if err != nil {
+			return err
+		}
+
+		// 绑定队列与交换机
+		return channel.QueueBind(
+			q.Name,
+			bindKey,
+			exchange,
+			false,
+			nil,
+		)
+	})
+}
+
+// deadLetterNames 死信交换机、死信队列以及绑定键名称
+func deadLetterNames(key string) (exchange, queue, bindKey string) {
+	return fmt.Sprintf("%s-dead-exchange", key), fmt.Sprintf("%s-dead-queue", key), fmt.Sprintf("%s-dead-bindkey", key)
+}
+
+func (r *RabbitMQ) Push(ctx context.Context, key, data string) error {
+	exchange := fmt.Sprintf("%s-exchange", key)
+	bindKey := fmt.Sprintf("%s-bindkey", key)
+
+	return r.withChannel(func(channel amqpChannel) error {
+		return channel.Publish(
+			exchange,
+			bindKey,
+			false,
+			false,
+			amqp.Publishing{
+				ContentType: "text/plain",
+				Body:        []byte(data),
+			})
+	})
+}
+
+// PushBatch 使用同一个通道批量发布数据，避免每条数据借还通道
+func (r *RabbitMQ) PushBatch(ctx context.Context, key string, data []string) error {
+	exchange := fmt.Sprintf("%s-exchange", key)
+	bindKey := fmt.Sprintf("%s-bindkey", key)
+
+	return r.withChannel(func(channel amqpChannel) error {
+		for _, datum := range data {
+			err := channel.Publish(
+				exchange,
+				bindKey,
+				false,
+				false,
+				amqp.Publishing{
+					ContentType: "text/plain",
+					Body:        []byte(datum),
+				})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Destroy 停止队列的消费者并等待消费协程退出，删除队列与交换机
+func (r *RabbitMQ) Destroy(ctx context.Context, key string) error {
+	exchange := fmt.Sprintf("%s-exchange", key)
+	queue := fmt.Sprintf("%s-queue", key)
+
+	r.lock.Lock()
+	c, ok := r.consumers[key]
+	delete(r.consumers, key)
+	r.lock.Unlock()
+	if ok {
+		// 等待消费协程退出后再删除队列
+		c.close()
+		<-c.done
 	}
 
-	// 绑定队列与交换机
-	err = r.channel.QueueBind(
-		q.Name,
-		bindKey,
-		exchange,
-		false,
-		nil,
-	)
+	return r.withChannel(func(channel amqpChannel) error {
+		_, err := channel.QueueDelete(queue, false, false, true)
+		if err != nil {
+			return err
+		}
+		err = channel.ExchangeDelete(exchange, false, false)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
 
-	if err != nil {
-		return err
+// DestroyDeadLetter 删除死信队列与死信交换机，排查或重放完成后调用
+func (r *RabbitMQ) DestroyDeadLetter(ctx context.Context, key string) error {
+	exchange, queue, _ := deadLetterNames(key)
+	return r.withChannel(func(channel amqpChannel) error {
+		_, err := channel.QueueDelete(queue, false, false, false)
+		if err != nil {
+			return err
+		}
+		return channel.ExchangeDelete(exchange, false, false)
+	})
+}
+
+// Close 停止所有消费者，断开channel 和 connection，关闭后不再重连
+func (r *RabbitMQ) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	r.lock.Lock()
+	for key, c := range r.consumers {
+		c.close()
+		delete(r.consumers, key)
 	}
-	return nil
+	r.lock.Unlock()
+	r.drainPublishers()
+
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	if r.conn.IsClosed() {
+		return nil
+	}
+	return r.conn.Close()
 }
 
-func (r *RabbitMQ) DeclareConsume(key string) error {
-	queue := fmt.Sprintf("%s-queue", key)
-	consumer, err := r.channel.Consume(
-		queue, // queue
-		// 用来区分多个消费者
-		"", // consumer
-		// 是否自动应答
-		true, // auto-ack
-		// 是否独有
-		false, // exclusive
-		// 设置为true，表示 不能将同一个Conenction中生产者发送的消息传递给这个Connection中 的消费者
-		false, // no-local
-		// 列是否阻塞
-		false, // no-wait
-		nil,   // args
-	)
+// dial 建立连接，同时注册连接断开通知
+func (r *RabbitMQ) dial() (*amqp.Connection, <-chan *amqp.Error, error) {
+	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:5672/%s", r.options.UserName, r.options.Password, r.options.Host, r.options.Vhost))
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return nil, nil, err
 	}
-
-	r.consumer[key] = consumer
-	return nil
+	return conn, conn.NotifyClose(make(chan *amqp.Error, 1)), nil
 }
 
-func (r *RabbitMQ) Push(ctx context.Context, key, data string) error {
-	exchange := fmt.Sprintf("%s-exchange", key)
-	bindKey := fmt.Sprintf("%s-bindkey", key)
+// watch 监听连接断开，按指数退避重连，重连成功后丢弃旧连接的发布通道
+func (r *RabbitMQ) watch(closes <-chan *amqp.Error) {
+	for {
+		closeErr, ok := <-closes
+		if !ok || closeErr == nil {
+			// 主动关闭连接
+			return
+		}
+		r.options.Logger.WithError(closeErr).Warn("rabbitmq connection closed")
 
-	err := r.channel.Publish(
-		exchange,
-		bindKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        []byte(data),
-		})
-	return err
-}
-
-// Pop 消费队列
-func (r *RabbitMQ) Pop(ctx context.Context, key string) <-chan string {
-	list := make(chan string)
-	var (
-		get  amqp.Delivery
-		item string
-	)
-
-	go func() {
+		var conn *amqp.Connection
+		delay := r.options.ReconnectDelay
 		for {
-			done := false
 			select {
-			case get = <-r.consumer[key]:
-				item = string(get.Body)
-				if item != "" {
-					list <- item
-				}
-				done = true
-				break
-			case <-time.After(5 * time.Second):
-				_, ok := <-list
-				if !ok {
-					close(list)
-				}
+			case <-r.closed:
+				return
+			case <-time.After(delay):
 			}
-			if done {
+
+			var err error
+			conn, closes, err = r.dial()
+			if err == nil {
 				break
 			}
+			r.options.Logger.WithError(err).Error("rabbitmq reconnect failed")
+			delay = r.backoff(delay)
 		}
-	}()
-	return list
+
+		r.connLock.Lock()
+		select {
+		case <-r.closed:
+			// 重连期间已关闭
+			r.connLock.Unlock()
+			_ = conn.Close()
+			return
+		default:
+		}
+		r.conn = conn
+		r.connLock.Unlock()
+		r.drainPublishers()
+	}
 }
 
-// Destroy 断开channel 和 connection
-func (r *RabbitMQ) Destroy(ctx context.Context, key string) error {
-	exchange := fmt.Sprintf("%s-exchange", key)
-	queue := fmt.Sprintf("%s-queue", key)
+// backoff 计算下一次重连等待时间
+func (r *RabbitMQ) backoff(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > r.options.ReconnectMaxDelay {
+		delay = r.options.ReconnectMaxDelay
+	}
+	return delay
+}
 
-	_, err := r.channel.QueueDelete(queue, false, false, true)
-	if err != nil {
-		fmt.Println(err)
-		return err
+// connection 获取当前连接，连接断开时返回ErrNotConnected
+func (r *RabbitMQ) connection() (*amqp.Connection, error) {
+	r.connLock.RLock()
+	defer r.connLock.RUnlock()
+	if r.conn == nil || r.conn.IsClosed() {
+		return nil, ErrNotConnected
 	}
-	err = r.channel.ExchangeDelete(exchange, false, false)
+	return r.conn, nil
+}
+
+// withChannel 从通道池借出通道执行操作，出错的通道可能已被服务端关闭，直接丢弃
+func (r *RabbitMQ) withChannel(fn func(channel amqpChannel) error) error {
+	var channel amqpChannel
+	select {
+	case channel = <-r.publishers:
+	default:
+		var err error
+		channel, err = r.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := fn(channel)
 	if err != nil {
-		fmt.Println(err)
+		_ = channel.Close()
 		return err
 	}
+
+	select {
+	case r.publishers <- channel:
+	default:
+		// 通道池已满
+		_ = channel.Close()
+	}
 	return nil
 }
 
-func (r *RabbitMQ) Close() error {
-	err := r.channel.Close()
+// openChannel 从当前连接打开新的通道
+func (r *RabbitMQ) openChannel() (amqpChannel, error) {
+	conn, err := r.connection()
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return nil, err
 	}
-	return r.conn.Close()
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
 }
 
-// failOnErr 错误处理函数
-func (r *RabbitMQ) failOnErr(err error, message string) {
-	if err != nil {
-		log.Fatalf("%s:%s", message, err)
-		panic(fmt.Sprintf("%s:%s", message, err))
+// drainPublishers 关闭通道池中的所有通道
+func (r *RabbitMQ) drainPublishers() {
+	for {
+		select {
+		case channel := <-r.publishers:
+			_ = channel.Close()
+		default:
+			return
+		}
 	}
 }
@@ -0,0 +1,98 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// fakeChannel 记录发布的消息，设置err后所有操作返回该错误
+type fakeChannel struct {
+	amqpChannel
+	published []amqp.Publishing
+	exchanges []string
+	closed    bool
+	err       error
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.exchanges = append(c.exchanges, exchange)
+	c.published = append(c.published, msg)
+	return nil
+}
+
+func (c *fakeChannel) Close() error {
+	c.closed = true
+	return nil
+}
+
+// fakeOpen 替换实例打开通道的方法，返回打开的所有通道
+func fakeOpen(r *RabbitMQ) *[]*fakeChannel {
+	var channels []*fakeChannel
+	r.open = func() (amqpChannel, error) {
+		channel := &fakeChannel{}
+		channels = append(channels, channel)
+		return channel, nil
+	}
+	return &channels
+}
+
+func TestBackoff(t *testing.T) {
+	r := newTestRabbitMQ(Options{ReconnectDelay: 10 * time.Millisecond, ReconnectMaxDelay: 50 * time.Millisecond})
+
+	// 每次翻倍，不超过最大等待时间
+	delay := r.options.ReconnectDelay
+	for _, want := range []time.Duration{20, 40, 50, 50} {
+		delay = r.backoff(delay)
+		if delay != want*time.Millisecond {
+			t.Fatalf("backoff: got %v, want %v", delay, want*time.Millisecond)
+		}
+	}
+}
+
+func TestWithChannel(t *testing.T) {
+	r := newTestRabbitMQ(Options{PoolSize: 1})
+	channels := fakeOpen(r)
+
+	// 执行成功的通道归还通道池，下次复用
+	for i := 0; i < 2; i++ {
+		if err := r.withChannel(func(channel amqpChannel) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*channels) != 1 || (*channels)[0].closed {
+		t.Fatalf("channel was not reused: opened %d", len(*channels))
+	}
+
+	// 出错的通道关闭并丢弃，下次打开新的通道
+	errPublish := errors.New("publish failed")
+	err := r.withChannel(func(channel amqpChannel) error { return errPublish })
+	if !errors.Is(err, errPublish) {
+		t.Fatalf("withChannel: got %v, want %v", err, errPublish)
+	}
+	if !(*channels)[0].closed {
+		t.Fatal("failed channel was not closed")
+	}
+	if err = r.withChannel(func(channel amqpChannel) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(*channels) != 2 || (*channels)[1].closed {
+		t.Fatalf("failed channel was reused: opened %d", len(*channels))
+	}
+
+	// 通道池已满时关闭归还的通道
+	err = r.withChannel(func(channel amqpChannel) error {
+		return r.withChannel(func(channel amqpChannel) error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*channels) != 3 || !(*channels)[1].closed || (*channels)[2].closed {
+		t.Fatalf("extra channel was not closed: opened %d", len(*channels))
+	}
+}
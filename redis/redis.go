@@ -3,7 +3,10 @@ package redis
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-redis/redis/v8"
+	"math/rand"
+	"os"
 	"sync"
 	"time"
 )
@@ -25,12 +28,24 @@ type Redis struct {
 	PbFns sync.Map
 	// 读写锁
 	lock sync.Mutex
+	// 队列消费者，每个队列只有一个长期运行的消费协程
+	consumers sync.Map
+	// 阻塞拉取队列数据的超时时间
+	popTimeout time.Duration
 }
 
 type Options struct {
-	Addr     string
-	Password string
-	DB       int
+	Addr       string
+	Password   string
+	DB         int
+	PopTimeout time.Duration // 阻塞拉取队列数据的超时时间，超时后重新拉取，同时用于检查队列是否已销毁，默认1秒
+}
+
+// queueConsumer 队列消费者，停止时取消ctx中断阻塞中的拉取，退出后关闭数据通道
+type queueConsumer struct {
+	list   chan string
+	cancel context.CancelFunc
+	done   chan struct{} // 消费协程退出后关闭
 }
 
 func New(ctx context.Context, options Options) *Redis {
@@ -43,6 +58,10 @@ func New(ctx context.Context, options Options) *Redis {
 	})
 
 	instance.PbFns = sync.Map{}
+	instance.popTimeout = options.PopTimeout
+	if instance.popTimeout <= 0 {
+		instance.popTimeout = time.Second
+	}
 	go func() {
 		pubSub := instance.Point.Subscribe(ctx, "__keyevent@0__:expired")
 		for {
@@ -92,7 +111,9 @@ func (r *Redis) Get(ctx context.Context, k string) (string, error) {
 	return data, nil
 }
 
+// Destroy 删除键，键为队列时先停止队列的消费协程，避免阻塞中的拉取取走重新创建的同名队列的数据
 func (r *Redis) Destroy(ctx context.Context, key string) error {
+	stopConsumer(&r.consumers, key)
 	return r.Point.Del(ctx, key).Err()
 }
 
@@ -165,26 +186,119 @@ func (r *Redis) CreateQueue(ctx context.Context, k string) error {
 	return err
 }
 
+// Push 从队列头部推送数据，Pop从尾部拉取，保证先进先出
 func (r *Redis) Push(ctx context.Context, k, field string) error {
 	return r.Point.LPush(ctx, k, field).Err()
 }
 
+// batchSize 批量推送时单条命令的最大数据量
+const batchSize = 1000
+
+// PushBatch 使用管道批量推送数据，每条LPUSH命令最多推送batchSize条数据，保证先进先出
+func (r *Redis) PushBatch(ctx context.Context, k string, data []string) error {
+	_, err := r.Point.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for start := 0; start < len(data); start += batchSize {
+			end := start + batchSize
+			if end > len(data) {
+				end = len(data)
+			}
+			values := make([]interface{}, 0, end-start)
+			for _, datum := range data[start:end] {
+				values = append(values, datum)
+			}
+			pipe.LPush(ctx, k, values...)
+		}
+		return nil
+	})
+	return err
+}
+
+// Pop 获取队列的数据通道，每个队列只启动一个使用BRPOP阻塞拉取数据的消费协程，多次调用返回同一个通道
+// 消费协程在队列销毁或ctx结束时退出，退出后通道关闭
 func (r *Redis) Pop(ctx context.Context, k string) <-chan string {
-	list := make(chan string)
-	result, err := r.Point.LPop(ctx, k).Result()
-	if err != nil {
-		return list
+	return startConsumer(ctx, &r.consumers, k, r.popTimeout, func(ctx context.Context) (string, error) {
+		result, err := r.Point.BRPop(ctx, r.popTimeout, k).Result()
+		if err != nil {
+			return "", err
+		}
+		// result[0]为队列key，result[1]为数据
+		return result[1], nil
+	}, func(data string) {
+		// 数据放回队列尾部，下次拉取时优先消费
+		_ = r.Point.RPush(context.Background(), k, data).Err()
+	})
+}
+
+// popFunc 阻塞拉取一条队列数据，超时无数据时返回redis.Nil
+type popFunc func(ctx context.Context) (string, error)
+
+// startConsumer 获取队列的消费者通道，队列没有消费者时启动消费协程
+// restore在消费者停止时归还已拉取但未被读取的数据
+func startConsumer(ctx context.Context, consumers *sync.Map, k string, retry time.Duration, pop popFunc, restore func(data string)) <-chan string {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &queueConsumer{list: make(chan string), cancel: cancel, done: make(chan struct{})}
+	actual, loaded := consumers.LoadOrStore(k, c)
+	if loaded {
+		cancel()
+		return actual.(*queueConsumer).list
 	}
+	go c.consume(ctx, consumers, k, retry, pop, restore)
+	return c.list
+}
 
-	go func() {
-		for {
-			if result != "" {
-				list <- result
-				break
+// stopConsumer 停止队列的消费协程，并等待协程退出
+func stopConsumer(consumers *sync.Map, k string) {
+	if c, ok := consumers.LoadAndDelete(k); ok {
+		c.(*queueConsumer).cancel()
+		<-c.(*queueConsumer).done
+	}
+}
+
+// consume 阻塞拉取队列数据并发送到消费者通道，ctx结束时退出并关闭消费者通道
+func (c *queueConsumer) consume(ctx context.Context, consumers *sync.Map, k string, retry time.Duration, pop popFunc, restore func(data string)) {
+	defer func() {
+		consumers.CompareAndDelete(k, c)
+		close(c.list)
+		close(c.done)
+	}()
+
+	for ctx.Err() == nil {
+		data, err := pop(ctx)
+		if errors.Is(err, redis.Nil) {
+			// 拉取超时，队列暂无数据
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// 连接异常，等待后重试
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
 			}
+			continue
 		}
-	}()
-	return list
+
+		if ctx.Err() != nil {
+			// 拉取完成时消费者已停止
+			restore(data)
+			return
+		}
+		select {
+		case c.list <- data:
+		case <-ctx.Done():
+			restore(data)
+			return
+		}
+	}
+}
+
+// defaultConsumerID 默认消费者ID，由主机名、进程号与随机数组成，避免多个进程重复
+func defaultConsumerID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), rand.Int63())
 }
 
 // GetOriginPoint 获取原始redis实例
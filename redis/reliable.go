@@ -0,0 +1,196 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"sync"
+	"time"
+)
+
+// ReliableOptions 可靠队列配置
+type ReliableOptions struct {
+	Prefix           string        // 元数据键前缀，默认ec_reliable
+	ConsumerID       string        // 消费者ID，不同进程不能重复，默认为主机名、进程号与随机数的组合
+	HeartbeatTimeout time.Duration // 心跳超时时间，超过该时间未续期的消费者视为已退出，默认30秒
+	RecoverInterval  time.Duration // 恢复已退出消费者数据的间隔，默认与心跳超时时间相同
+}
+
+// ReliableQueue 至少一次投递的redis队列，拉取数据时使用BLMOVE原子地移动到当前消费者的处理中列表，确认后才删除
+// 消费者异常退出后心跳过期，其处理中列表的数据由其他消费者的恢复协程放回队列重新消费
+type ReliableQueue struct {
+	r          *Redis
+	options    ReliableOptions
+	consumers  sync.Map
+	registered sync.Map // 已登记处理中列表的队列
+}
+
+// NewReliableQueue 创建可靠队列，同时启动心跳与恢复协程，ctx结束时协程退出
+func NewReliableQueue(ctx context.Context, r *Redis, options ReliableOptions) *ReliableQueue {
+	if options.Prefix == "" {
+		options.Prefix = "ec_reliable"
+	}
+	if options.ConsumerID == "" {
+		options.ConsumerID = defaultConsumerID()
+	}
+	if options.HeartbeatTimeout <= 0 {
+		options.HeartbeatTimeout = 30 * time.Second
+	}
+	if options.RecoverInterval <= 0 {
+		options.RecoverInterval = options.HeartbeatTimeout
+	}
+
+	q := &ReliableQueue{r: r, options: options}
+	_ = q.beat(ctx)
+	go q.keepalive(ctx)
+	return q
+}
+
+func (q *ReliableQueue) CreateQueue(ctx context.Context, k string) error {
+	return q.r.CreateQueue(ctx, k)
+}
+
+// Push 从队列头部推送数据，Pop从尾部拉取，保证先进先出
+func (q *ReliableQueue) Push(ctx context.Context, k, data string) error {
+	return q.r.Push(ctx, k, data)
+}
+
+func (q *ReliableQueue) PushBatch(ctx context.Context, k string, data []string) error {
+	return q.r.PushBatch(ctx, k, data)
+}
+
+// Pop 获取队列的数据通道，拉取的数据在Ack之前保留在当前消费者的处理中列表
+func (q *ReliableQueue) Pop(ctx context.Context, k string) <-chan string {
+	if _, loaded := q.registered.LoadOrStore(k, struct{}{}); !loaded {
+		// 登记处理中列表，恢复协程与Destroy根据登记信息查找
+		_, err := q.r.Point.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SAdd(ctx, q.queuesKey(), k)
+			pipe.SAdd(ctx, q.consumersKey(k), q.options.ConsumerID)
+			return nil
+		})
+		if err != nil {
+			q.registered.Delete(k)
+		}
+	}
+
+	processing := q.processingKey(k, q.options.ConsumerID)
+	return startConsumer(ctx, &q.consumers, k, q.r.popTimeout, func(ctx context.Context) (string, error) {
+		return q.r.Point.BLMove(ctx, k, processing, "RIGHT", "LEFT", q.r.popTimeout).Result()
+	}, func(data string) {
+		// 数据从处理中列表放回队列尾部，下次拉取时优先消费
+		_, _ = q.r.Point.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+			pipe.LRem(context.Background(), processing, -1, data)
+			pipe.RPush(context.Background(), k, data)
+			return nil
+		})
+	})
+}
+
+// Ack 确认数据已处理，从处理中列表删除
+func (q *ReliableQueue) Ack(ctx context.Context, k, data string) error {
+	return q.r.Point.LRem(ctx, q.processingKey(k, q.options.ConsumerID), -1, data).Err()
+}
+
+// Destroy 删除队列以及所有消费者的处理中列表，同时停止队列的消费协程
+func (q *ReliableQueue) Destroy(ctx context.Context, k string) error {
+	stopConsumer(&q.consumers, k)
+	q.registered.Delete(k)
+
+	consumers, err := q.r.Point.SMembers(ctx, q.consumersKey(k)).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{k, q.consumersKey(k)}
+	for _, consumer := range consumers {
+		keys = append(keys, q.processingKey(k, consumer))
+	}
+	_, err = q.r.Point.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		pipe.SRem(ctx, q.queuesKey(), k)
+		return nil
+	})
+	return err
+}
+
+// Recover 将心跳已过期的消费者处理中列表的数据放回队列尾部，保持原有的消费顺序
+func (q *ReliableQueue) Recover(ctx context.Context) error {
+	queues, err := q.r.Point.SMembers(ctx, q.queuesKey()).Result()
+	if err != nil {
+		return err
+	}
+	for _, k := range queues {
+		consumers, err := q.r.Point.SMembers(ctx, q.consumersKey(k)).Result()
+		if err != nil {
+			return err
+		}
+		for _, consumer := range consumers {
+			if consumer == q.options.ConsumerID {
+				continue
+			}
+			alive, err := q.r.Point.Exists(ctx, q.heartbeatKey(consumer)).Result()
+			if err != nil {
+				return err
+			}
+			if alive > 0 {
+				continue
+			}
+
+			// 处理中列表头部为最新拉取的数据，依次放回队列尾部后最早拉取的数据位于尾部
+			processing := q.processingKey(k, consumer)
+			for {
+				err = q.r.Point.LMove(ctx, processing, k, "LEFT", "RIGHT").Err()
+				if errors.Is(err, redis.Nil) {
+					break
+				}
+				if err != nil {
+					return err
+				}
+			}
+			err = q.r.Point.SRem(ctx, q.consumersKey(k), consumer).Err()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keepalive 定时续期心跳并恢复已退出消费者的数据，ctx结束时删除心跳，其他消费者无需等待过期即可恢复
+func (q *ReliableQueue) keepalive(ctx context.Context) {
+	heartbeat := time.NewTicker(q.options.HeartbeatTimeout / 3)
+	defer heartbeat.Stop()
+	recovery := time.NewTicker(q.options.RecoverInterval)
+	defer recovery.Stop()
+
+	for {
+		select {
+		case <-heartbeat.C:
+			_ = q.beat(ctx)
+		case <-recovery.C:
+			_ = q.Recover(ctx)
+		case <-ctx.Done():
+			_ = q.r.Point.Del(context.Background(), q.heartbeatKey(q.options.ConsumerID)).Err()
+			return
+		}
+	}
+}
+
+func (q *ReliableQueue) beat(ctx context.Context) error {
+	return q.r.Set(ctx, q.heartbeatKey(q.options.ConsumerID), "1", q.options.HeartbeatTimeout)
+}
+
+func (q *ReliableQueue) queuesKey() string {
+	return q.options.Prefix + ":queues"
+}
+
+func (q *ReliableQueue) heartbeatKey(consumer string) string {
+	return q.options.Prefix + ":heartbeat:" + consumer
+}
+
+func (q *ReliableQueue) consumersKey(k string) string {
+	return k + ":consumers"
+}
+
+func (q *ReliableQueue) processingKey(k, consumer string) string {
+	return k + ":processing:" + consumer
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Signaler 基于redis发布订阅的任务开启信号，生产者与导出服务可以部署在不同的主机
+// 发送信号时同时写入信号键，保证在发布之后才开始等待的导出协程也能收到信号
+type Signaler struct {
+	r      *Redis
+	prefix string
+	expire time.Duration
+}
+
+// NewSignaler 创建开启信号，prefix为信号键前缀，expire为信号键过期时间，默认24小时
+func NewSignaler(r *Redis, prefix string, expire time.Duration) *Signaler {
+	if prefix == "" {
+		prefix = "ec_start_signal"
+	}
+	if expire <= 0 {
+		expire = 24 * time.Hour
+	}
+	return &Signaler{r: r, prefix: prefix, expire: expire}
+}
+
+func (s *Signaler) Notify(ctx context.Context, id int64) error {
+	key := s.key(id)
+	err := s.r.Set(ctx, key, "1", s.expire)
+	if err != nil {
+		return err
+	}
+	return s.r.Point.Publish(ctx, key, "1").Err()
+}
+
+func (s *Signaler) Wait(ctx context.Context, id int64) error {
+	key := s.key(id)
+	pubSub := s.r.Point.Subscribe(ctx, key)
+	defer pubSub.Close()
+
+	// 确认订阅成功后再检查信号键，避免错过订阅之前发布的信号
+	_, err := pubSub.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	signal, err := s.r.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if signal != "" {
+		return nil
+	}
+
+	select {
+	case <-pubSub.Channel():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Signaler) Clear(ctx context.Context, id int64) error {
+	return s.r.Point.Del(ctx, s.key(id)).Err()
+}
+
+func (s *Signaler) key(id int64) string {
+	return fmt.Sprintf("%s:%d", s.prefix, id)
+}
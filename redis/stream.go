@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/DanPlayer/exportcenter/internal/pending"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamField 数据在stream消息中的字段名
+const streamField = "d"
+
+// StreamOptions stream队列配置
+type StreamOptions struct {
+	Group     string        // 消费组名称，共享同一个任务的导出进程需使用相同的消费组，默认exportcenter
+	Consumer  string        // 消费者名称，不同进程不能重复，默认为主机名、进程号与随机数的组合
+	ClaimIdle time.Duration // 消息未确认超过该时间后由其他消费者认领重新投递，默认1分钟
+	ClaimSize int64         // 每次认领的最大消息数量，默认100
+}
+
+// StreamQueue 基于redis stream与消费组的队列，多个导出进程可以共同消费同一个任务的数据表
+// 消息在Ack之前保留在消费组的待确认列表中，消费者异常退出后未确认的消息超时后被其他消费者认领
+type StreamQueue struct {
+	r         *Redis
+	options   StreamOptions
+	consumers sync.Map
+	pending   sync.Map // 每个队列已投递未确认的消息ID
+}
+
+func NewStreamQueue(r *Redis, options StreamOptions) *StreamQueue {
+	if options.Group == "" {
+		options.Group = "exportcenter"
+	}
+	if options.Consumer == "" {
+		options.Consumer = defaultConsumerID()
+	}
+	if options.ClaimIdle <= 0 {
+		options.ClaimIdle = time.Minute
+	}
+	if options.ClaimSize <= 0 {
+		options.ClaimSize = 100
+	}
+	return &StreamQueue{r: r, options: options}
+}
+
+// CreateQueue 创建stream以及消费组，消费组已存在时忽略
+func (q *StreamQueue) CreateQueue(ctx context.Context, k string) error {
+	err := q.r.Point.XGroupCreateMkStream(ctx, k, q.options.Group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+func (q *StreamQueue) Push(ctx context.Context, k, data string) error {
+	return q.r.Point.XAdd(ctx, &redis.XAddArgs{
+		Stream: k,
+		Values: []interface{}{streamField, data},
+	}).Err()
+}
+
+// PushBatch 使用管道批量推送数据
+func (q *StreamQueue) PushBatch(ctx context.Context, k string, data []string) error {
+	_, err := q.r.Point.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, datum := range data {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: k,
+				Values: []interface{}{streamField, datum},
+			})
+		}
+		return nil
+	})
+	return err
+}
+
+// Pop 获取队列的数据通道，优先认领其他消费者超时未确认的消息，再读取新消息
+func (q *StreamQueue) Pop(ctx context.Context, k string) <-chan string {
+	var (
+		messages  []redis.XMessage
+		lastClaim time.Time
+	)
+	return startConsumer(ctx, &q.consumers, k, q.r.popTimeout, func(ctx context.Context) (string, error) {
+		for {
+			if len(messages) == 0 && time.Since(lastClaim) >= q.options.ClaimIdle {
+				lastClaim = time.Now()
+				claimed, err := q.claim(ctx, k)
+				if err != nil {
+					return "", err
+				}
+				messages = claimed
+			}
+			if len(messages) == 0 {
+				streams, err := q.r.Point.XReadGroup(ctx, &redis.XReadGroupArgs{
+					Group:    q.options.Group,
+					Consumer: q.options.Consumer,
+					Streams:  []string{k, ">"},
+					Count:    1,
+					Block:    q.r.popTimeout,
+				}).Result()
+				if err != nil {
+					return "", err
+				}
+				for _, stream := range streams {
+					messages = append(messages, stream.Messages...)
+				}
+			}
+			if len(messages) == 0 {
+				return "", redis.Nil
+			}
+
+			message := messages[0]
+			messages = messages[1:]
+			data, ok := message.Values[streamField].(string)
+			if !ok {
+				// 消息已被删除或格式错误，直接确认
+				_ = q.r.Point.XAck(ctx, k, q.options.Group, message.ID).Err()
+				continue
+			}
+			q.pendingOf(k).Push(data, message.ID)
+			return data, nil
+		}
+	}, func(data string) {
+		// 消息保留在待确认列表，超时后重新认领
+		q.pendingOf(k).Pop(data)
+	})
+}
+
+// Ack 确认消息已处理，从消费组的待确认列表删除
+func (q *StreamQueue) Ack(ctx context.Context, k, data string) error {
+	id, ok := q.pendingOf(k).Pop(data)
+	if !ok {
+		return nil
+	}
+	return q.r.Point.XAck(ctx, k, q.options.Group, id).Err()
+}
+
+// Destroy 删除stream以及消费组，同时停止队列的消费协程
+func (q *StreamQueue) Destroy(ctx context.Context, k string) error {
+	stopConsumer(&q.consumers, k)
+	q.pending.Delete(k)
+	return q.r.Point.Del(ctx, k).Err()
+}
+
+// claim 认领超时未确认的消息，redis 7的XAUTOCLAIM返回三个元素，go-redis v8只能解析两个元素，因此手动解析
+func (q *StreamQueue) claim(ctx context.Context, k string) ([]redis.XMessage, error) {
+	reply, err := q.r.Point.Do(ctx, "xautoclaim", k, q.options.Group, q.options.Consumer,
+		int64(q.options.ClaimIdle/time.Millisecond), "0-0", "count", q.options.ClaimSize).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < 2 {
+		return nil, fmt.Errorf("xautoclaim: unexpected reply length %d", len(reply))
+	}
+	entries, _ := reply[1].([]interface{})
+
+	messages := make([]redis.XMessage, 0, len(entries))
+	for _, entry := range entries {
+		// 已删除的消息为nil或没有字段
+		fields, _ := entry.([]interface{})
+		if len(fields) != 2 {
+			continue
+		}
+		id, _ := fields[0].(string)
+		values, _ := fields[1].([]interface{})
+		message := redis.XMessage{ID: id, Values: make(map[string]interface{}, len(values)/2)}
+		for i := 0; i+1 < len(values); i += 2 {
+			field, _ := values[i].(string)
+			message.Values[field] = values[i+1]
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (q *StreamQueue) pendingOf(k string) *pending.Pending[string] {
+	p, _ := q.pending.LoadOrStore(k, pending.New[string]())
+	return p.(*pending.Pending[string])
+}
@@ -0,0 +1,229 @@
+package exportcenter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotStruct 数据行类型不是结构体
+var ErrNotStruct = errors.New("数据行类型必须为结构体或结构体指针")
+
+// defaultTimeFormat 时间字段未配置format时的格式
+const defaultTimeFormat = "2006-01-02 15:04:05"
+
+// envelopeRows PushRows每条多行消息携带的最大行数
+const envelopeRows = 100
+
+// exportField 结构体的导出字段，通过export标签配置：
+// export:"header=名称,order=1,format=2006-01-02"，export:"-"忽略字段
+// header默认为字段名，order越小越靠前，未配置order的字段按声明顺序排在最后
+// format对时间字段为时间格式，默认2006-01-02 15:04:05，对其他字段为fmt格式，如%.2f
+// 选项以逗号分隔，header不能包含逗号，format必须为最后一个选项，之后的内容包括逗号全部作为格式
+type exportField struct {
+	index  []int
+	header string
+	order  int
+	format string
+}
+
+// exportFieldsCache 结构体类型的导出字段缓存
+var exportFieldsCache sync.Map
+
+// HeaderOf 根据结构体的export标签生成标题
+func HeaderOf[T any]() ([]string, error) {
+	fields, err := exportFieldsOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	header := make([]string, 0, len(fields))
+	for _, field := range fields {
+		header = append(header, field.header)
+	}
+	return header, nil
+}
+
+// CreateTaskFor 创建导出任务，options未配置标题时根据T的export标签生成
+func CreateTaskFor[T any](ec *ExportCenter, key, name, description, source, destination, format string, count int64, options ExportOptions) (uint, []string, error) {
+	if len(options.Header) == 0 {
+		header, err := HeaderOf[T]()
+		if err != nil {
+			return 0, nil, err
+		}
+		options.Header = header
+	}
+	return ec.CreateTask(key, name, description, source, destination, format, count, options)
+}
+
+// PushRows 按T的export标签将数据行序列化为与标题顺序一致的数组，打包为多行消息批量推送
+func PushRows[T any](ec *ExportCenter, key string, rows []T) error {
+	fields, err := exportFieldsOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+
+	data := make([]string, 0, (len(rows)+envelopeRows-1)/envelopeRows)
+	for start := 0; start < len(rows); start += envelopeRows {
+		end := start + envelopeRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		envelope := Envelope{Version: EnvelopeVersion, Rows: make([][]interface{}, 0, end-start)}
+		for _, row := range rows[start:end] {
+			envelope.Rows = append(envelope.Rows, rowOf(reflect.ValueOf(row), fields))
+		}
+		marshal, err := json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		data = append(data, string(marshal))
+	}
+	return ec.PushBatch(key, data)
+}
+
+// exportFieldsOf 解析结构体的导出字段，结果按类型缓存
+func exportFieldsOf(t reflect.Type) ([]exportField, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+	if fields, ok := exportFieldsCache.Load(t); ok {
+		return fields.([]exportField), nil
+	}
+
+	fields, err := collectFields(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].order < fields[j].order
+	})
+	exportFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+// collectFields 收集结构体的导出字段，匿名结构体字段展开
+func collectFields(t reflect.Type, parent []int) ([]exportField, error) {
+	var fields []exportField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("export")
+		if tag == "-" {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && !tagged && ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			embedded, err := collectFields(ft, index)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		field := exportField{index: index, header: sf.Name, order: math.MaxInt}
+		for rest := tag; rest != ""; {
+			// 格式可能包含逗号，format之后的内容全部作为格式
+			var option string
+			if strings.HasPrefix(strings.TrimSpace(rest), "format=") {
+				option, rest = rest, ""
+			} else {
+				option, rest, _ = strings.Cut(rest, ",")
+			}
+			k, v, ok := strings.Cut(option, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s字段export标签格式错误：%s", sf.Name, option)
+			}
+			switch strings.TrimSpace(k) {
+			case "header":
+				field.header = v
+			case "order":
+				order, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s字段export标签order必须为整数：%s", sf.Name, v)
+				}
+				field.order = order
+			case "format":
+				field.format = v
+			default:
+				return nil, fmt.Errorf("%s字段export标签不支持%s", sf.Name, k)
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// rowOf 按导出字段生成数据行，空指针字段为空值
+func rowOf(v reflect.Value, fields []exportField) []interface{} {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return make([]interface{}, len(fields))
+		}
+		v = v.Elem()
+	}
+
+	row := make([]interface{}, len(fields))
+	for i, field := range fields {
+		fv, ok := fieldByIndex(v, field.index)
+		if !ok {
+			continue
+		}
+		row[i] = formatField(fv, field.format)
+	}
+	return row
+}
+
+// fieldByIndex 获取嵌套字段，途经空指针时返回false
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// formatField 按format格式化字段值
+func formatField(v reflect.Value, format string) interface{} {
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return nil
+		}
+		if format == "" {
+			format = defaultTimeFormat
+		}
+		return t.Format(format)
+	}
+	if format != "" {
+		return fmt.Sprintf(format, v.Interface())
+	}
+	return v.Interface()
+}
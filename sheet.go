@@ -0,0 +1,94 @@
+package exportcenter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSheetNameLength excel数据表名称的最大长度
+const maxSheetNameLength = 31
+
+// sheetNameReplacer 替换excel数据表名称不允许使用的字符
+var sheetNameReplacer = strings.NewReplacer(":", "_", "\\", "_", "/", "_", "?", "_", "*", "_", "[", "(", "]", ")")
+
+// SheetQueue 数据表与对应的数据队列
+type SheetQueue struct {
+	Key  string `json:"key"`  // 队列key
+	Name string `json:"name"` // 数据表名称，流式任务为第一个数据表的名称
+}
+
+// sheetNamer 数据表名称生成器，优先使用SheetNames，其次按SheetName模板生成，名称不区分大小写去重
+type sheetNamer struct {
+	names    []string
+	replacer *strings.Replacer
+	template string
+	used     map[string]struct{}
+}
+
+// newSheetNamer 创建数据表名称生成器，模板支持{index}数据表序号、{name}任务名称、{date}任务创建日期，
+// {start}、{end}为导出选项中的数据范围RangeStart、RangeEnd
+func newSheetNamer(task Task, options ExportOptions) *sheetNamer {
+	template := options.SheetName
+	if template == "" {
+		template = "Sheet{index}"
+	}
+	return &sheetNamer{
+		names:    options.SheetNames,
+		template: template,
+		replacer: strings.NewReplacer(
+			"{name}", task.Name,
+			"{date}", task.CreatedAt.Local().Format("2006-01-02"),
+			"{start}", options.RangeStart,
+			"{end}", options.RangeEnd,
+		),
+		// History为excel的保留名称
+		used: map[string]struct{}{"history": {}},
+	}
+}
+
+// name 生成第index个数据表的名称，index从1开始，必须按顺序调用以保证相同配置生成的名称一致
+func (n *sheetNamer) name(index int) string {
+	name := ""
+	if index <= len(n.names) {
+		name = n.names[index-1]
+	}
+	if name == "" {
+		name = strings.ReplaceAll(n.replacer.Replace(n.template), "{index}", strconv.Itoa(index))
+	}
+	return n.unique(name, index)
+}
+
+// unique 清理名称并去重，重名时增加序号，如Orders (2)，清理后为空时使用Sheet{index}
+func (n *sheetNamer) unique(name string, index int) string {
+	name = sanitizeSheetName(name)
+	if name == "" {
+		name = fmt.Sprintf("Sheet%d", index)
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := n.used[strings.ToLower(unique)]; !ok {
+			break
+		}
+		suffix := fmt.Sprintf(" (%d)", i)
+		unique = truncateRunes(name, maxSheetNameLength-len(suffix)) + suffix
+	}
+	n.used[strings.ToLower(unique)] = struct{}{}
+	return unique
+}
+
+// sanitizeSheetName 替换excel不允许的字符，去除首尾的单引号，截断至31个字符
+func sanitizeSheetName(name string) string {
+	name = strings.Trim(sheetNameReplacer.Replace(name), "'")
+	return strings.TrimRight(truncateRunes(name, maxSheetNameLength), "'")
+}
+
+// truncateRunes 按字符截断
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,124 @@
+package exportcenter
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// Signaler 任务开启信号，StartTask发送信号，导出协程收到信号后开始导出
+// 生产者与导出服务不在同一进程时，需要使用redis、数据库等跨进程的实现
+type Signaler interface {
+	Notify(ctx context.Context, id int64) error // 发送开启信号，信号会保留到被清除，先发送后等待也能收到
+	Wait(ctx context.Context, id int64) error   // 等待开启信号，ctx结束时返回ctx的错误
+	Clear(ctx context.Context, id int64) error  // 清除开启信号
+}
+
+// MemorySignaler 进程内的开启信号，生产者与导出在同一进程时使用
+type MemorySignaler struct {
+	signals map[int64]chan struct{}
+	lock    sync.Mutex
+}
+
+func NewMemorySignaler() *MemorySignaler {
+	return &MemorySignaler{signals: make(map[int64]chan struct{})}
+}
+
+func (s *MemorySignaler) Notify(ctx context.Context, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	signal := s.signal(id)
+	select {
+	case <-signal:
+	default:
+		close(signal)
+	}
+	return nil
+}
+
+func (s *MemorySignaler) Wait(ctx context.Context, id int64) error {
+	s.lock.Lock()
+	signal := s.signal(id)
+	s.lock.Unlock()
+
+	select {
+	case <-signal:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *MemorySignaler) Clear(ctx context.Context, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.signals, id)
+	return nil
+}
+
+// signal 获取任务的信号通道，通道关闭表示已开启，调用方需持有锁
+func (s *MemorySignaler) signal(id int64) chan struct{} {
+	signal, ok := s.signals[id]
+	if !ok {
+		signal = make(chan struct{})
+		s.signals[id] = signal
+	}
+	return signal
+}
+
+// TaskSignal 任务开启信号表，数据库轮询信号使用
+type TaskSignal struct {
+	ID        uint  `gorm:"primarykey"`
+	TaskID    int64 `gorm:"uniqueIndex;comment:任务ID"`
+	CreatedAt time.Time
+}
+
+// DbSignaler 基于数据库轮询的开启信号，不依赖其他中间件即可跨进程开启任务
+type DbSignaler struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+// NewDbSignaler 创建数据库轮询信号，interval为轮询间隔，默认1秒
+func NewDbSignaler(db *gorm.DB, interval time.Duration) (*DbSignaler, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	err := db.AutoMigrate(&TaskSignal{})
+	if err != nil {
+		return nil, err
+	}
+	return &DbSignaler{db: db, interval: interval}, nil
+}
+
+func (s *DbSignaler) Notify(ctx context.Context, id int64) error {
+	return s.db.WithContext(ctx).Where(TaskSignal{TaskID: id}).FirstOrCreate(&TaskSignal{}).Error
+}
+
+func (s *DbSignaler) Wait(ctx context.Context, id int64) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		var count int64
+		err := s.db.WithContext(ctx).Model(&TaskSignal{}).Where("task_id = ?", id).Count(&count).Error
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *DbSignaler) Clear(ctx context.Context, id int64) error {
+	return s.db.WithContext(ctx).Where("task_id = ?", id).Delete(&TaskSignal{}).Error
+}
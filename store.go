@@ -0,0 +1,266 @@
+package exportcenter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// ErrTaskNotFound 任务不存在
+var ErrTaskNotFound = errors.New("任务不存在")
+
+// TaskStore 任务存储，负责任务的创建、查询以及状态、进度、地址的更新
+// 除错误日志地址外，只有待处理与处理中的任务可以更新，已结束（完成、失败、废弃）的任务返回ErrTaskFinished
+type TaskStore interface {
+	Create(ctx context.Context, task *Task) error                                                 // 创建任务，创建后回写任务ID
+	Get(ctx context.Context, id int64) (Task, error)                                              // 获取任务，不存在时返回ErrTaskNotFound
+	UpdateStatus(ctx context.Context, id int64, status TaskStatus) error                          // 更新任务状态，处理中时记录开始时间
+	UpdateProgress(ctx context.Context, id int64, progressRate int, writeNum, errNum int64) error // 更新任务进度
+	UpdateCount(ctx context.Context, id int64, count int64) error                                 // 更新数据总数，流式任务结束时使用
+	Complete(ctx context.Context, id int64, writeNum int64) error                                 // 任务完成
+	Fail(ctx context.Context, id int64, errNum, writeNum int64) error                             // 任务失败
+	Abandon(ctx context.Context, id int64) error                                                  // 任务废弃
+	UpdateDownloadUrl(ctx context.Context, id int64, url string) error                            // 更新文件下载地址
+	UpdateErrLogUrl(ctx context.Context, id int64, url string) error                              // 更新错误日志地址
+}
+
+// GormStore 基于gorm的任务存储，支持MySQL、PostgreSQL、SQLite
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建gorm任务存储，并自动创建任务表
+func NewGormStore(db *gorm.DB) (*GormStore, error) {
+	migrator := db
+	if db.Dialector.Name() == "mysql" {
+		migrator = db.Set("gorm:table_options", "ENGINE=InnoDB")
+	}
+	err := migrator.AutoMigrate(&Task{})
+	if err != nil {
+		return nil, err
+	}
+	return &GormStore{db: db}, nil
+}
+
+func (s *GormStore) Create(ctx context.Context, task *Task) error {
+	return s.db.WithContext(ctx).Create(task).Error
+}
+
+func (s *GormStore) Get(ctx context.Context, id int64) (info Task, err error) {
+	err = s.db.WithContext(ctx).Where("id = ?", id).First(&info).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = ErrTaskNotFound
+	}
+	return
+}
+
+func (s *GormStore) UpdateStatus(ctx context.Context, id int64, status TaskStatus) error {
+	if status == TaskStatusConsult {
+		return s.update(ctx, id, map[string]interface{}{
+			"status":     status,
+			"start_time": time.Now(),
+		})
+	} else {
+		return s.update(ctx, id, map[string]interface{}{
+			"status": status,
+		})
+	}
+}
+
+func (s *GormStore) UpdateProgress(ctx context.Context, id int64, progressRate int, writeNum, errNum int64) error {
+	return s.update(ctx, id, map[string]interface{}{
+		"progress_rate": progressRate,
+		"write_num":     writeNum,
+		"err_num":       errNum,
+	})
+}
+
+func (s *GormStore) UpdateCount(ctx context.Context, id int64, count int64) error {
+	return s.update(ctx, id, map[string]interface{}{
+		"count_num": count,
+	})
+}
+
+func (s *GormStore) Complete(ctx context.Context, id int64, writeNum int64) error {
+	return s.update(ctx, id, map[string]interface{}{
+		"status":        TaskStatusCompleted,
+		"progress_rate": 100,
+		"end_time":      time.Now(),
+		"write_num":     writeNum,
+	})
+}
+
+func (s *GormStore) Fail(ctx context.Context, id int64, errNum, writeNum int64) error {
+	return s.update(ctx, id, map[string]interface{}{
+		"status":        TaskStatusFail,
+		"progress_rate": 100,
+		"end_time":      time.Now(),
+		"err_num":       errNum,
+		"write_num":     writeNum,
+	})
+}
+
+func (s *GormStore) Abandon(ctx context.Context, id int64) error {
+	return s.update(ctx, id, map[string]interface{}{
+		"status":   TaskStatusAbandon,
+		"end_time": time.Now(),
+	})
+}
+
+func (s *GormStore) UpdateDownloadUrl(ctx context.Context, id int64, url string) error {
+	return s.update(ctx, id, map[string]interface{}{
+		"download_url": url,
+	})
+}
+
+// UpdateErrLogUrl 更新错误日志地址，任务结束后也可以更新
+func (s *GormStore) UpdateErrLogUrl(ctx context.Context, id int64, url string) error {
+	return s.db.WithContext(ctx).Model(&Task{}).Where("id = ?", id).UpdateColumn("err_log_url", url).Error
+}
+
+// update 更新未结束的任务，没有更新任何记录时区分任务不存在、已结束以及数据未变化
+func (s *GormStore) update(ctx context.Context, id int64, columns map[string]interface{}) error {
+	result := s.db.WithContext(ctx).Model(&Task{}).
+		Where("id = ? AND status IN ?", id, []int{TaskStatusWait.ParseInt(), TaskStatusConsult.ParseInt()}).
+		UpdateColumns(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	task, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if task.isFinished() {
+		return ErrTaskFinished
+	}
+	return nil
+}
+
+// MemoryStore 内存任务存储，用于单元测试以及单进程部署，进程退出后任务记录丢失
+type MemoryStore struct {
+	tasks  map[int64]Task
+	nextID int64
+	lock   sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tasks: make(map[int64]Task)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, task *Task) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nextID++
+	now := time.Now()
+	task.ID = uint(s.nextID)
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	s.tasks[s.nextID] = *task
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id int64) (Task, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	task, ok := s.tasks[id]
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+func (s *MemoryStore) UpdateStatus(ctx context.Context, id int64, status TaskStatus) error {
+	return s.update(id, func(task *Task) {
+		task.Status = status.ParseInt()
+		if status == TaskStatusConsult {
+			task.StartTime = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	})
+}
+
+func (s *MemoryStore) UpdateProgress(ctx context.Context, id int64, progressRate int, writeNum, errNum int64) error {
+	return s.update(id, func(task *Task) {
+		task.ProgressRate = progressRate
+		task.WriteNum = writeNum
+		task.ErrNum = errNum
+	})
+}
+
+func (s *MemoryStore) UpdateCount(ctx context.Context, id int64, count int64) error {
+	return s.update(id, func(task *Task) {
+		task.CountNum = count
+	})
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, id int64, writeNum int64) error {
+	return s.update(id, func(task *Task) {
+		task.Status = TaskStatusCompleted.ParseInt()
+		task.ProgressRate = 100
+		task.EndTime = sql.NullTime{Time: time.Now(), Valid: true}
+		task.WriteNum = writeNum
+	})
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, id int64, errNum, writeNum int64) error {
+	return s.update(id, func(task *Task) {
+		task.Status = TaskStatusFail.ParseInt()
+		task.ProgressRate = 100
+		task.EndTime = sql.NullTime{Time: time.Now(), Valid: true}
+		task.ErrNum = errNum
+		task.WriteNum = writeNum
+	})
+}
+
+func (s *MemoryStore) Abandon(ctx context.Context, id int64) error {
+	return s.update(id, func(task *Task) {
+		task.Status = TaskStatusAbandon.ParseInt()
+		task.EndTime = sql.NullTime{Time: time.Now(), Valid: true}
+	})
+}
+
+func (s *MemoryStore) UpdateDownloadUrl(ctx context.Context, id int64, url string) error {
+	return s.update(id, func(task *Task) {
+		task.DownloadUrl = url
+	})
+}
+
+// UpdateErrLogUrl 更新错误日志地址，任务结束后也可以更新
+func (s *MemoryStore) UpdateErrLogUrl(ctx context.Context, id int64, url string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	task.ErrLogUrl = url
+	s.tasks[id] = task
+	return nil
+}
+
+// update 更新未结束的任务
+func (s *MemoryStore) update(id int64, fn func(task *Task)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if task.isFinished() {
+		return ErrTaskFinished
+	}
+	fn(&task)
+	task.UpdatedAt = time.Now()
+	s.tasks[id] = task
+	return nil
+}
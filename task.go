@@ -3,35 +3,45 @@ package exportcenter
 import (
 	"database/sql"
 	"gorm.io/gorm"
-	"time"
 )
 
 // Task 任务表
-// 用于记录所有的到处任务以及导出状态
+// 用于记录所有的到处任务以及导出状态，字段类型不依赖具体数据库，支持MySQL、PostgreSQL、SQLite
 type Task struct {
 	gorm.Model
-	Name          string       `gorm:"type:varchar(255);comment:'任务名称'"`
-	Description   string       `gorm:"type:text;comment:'描述'"`
-	Status        int          `gorm:"type:tinyint(1);default:1;comment:'状态 1-待处理、2-处理中、3-已完成、4-失败、5-任务废弃'"`
-	ProgressRate  int          `gorm:"type:tinyint(3);default:0;comment:'任务进度1-100'"`
-	StartTime     sql.NullTime `gorm:"type:datetime;comment:'任务开始时间'"`
-	EndTime       sql.NullTime `gorm:"type:datetime;comment:'任务结束时间'"`
-	Source        string       `gorm:"type:varchar(255);comment:'数据源，描述导出数据的来源'"`
-	Destination   string       `gorm:"type:varchar(255);comment:'数据目标，描述导出数据的存储位置'"`
-	ExportFormat  string       `gorm:"type:varchar(255);comment:'导出格式，如CSV、JSON、XML等'"`
-	ExportOptions string       `gorm:"type:text;comment:'导出选项，可存储导出任务的配置信息（可选）'"`
-	QueueKey      string       `gorm:"type:varchar(255);comment:'队列key'"`
-	CountNum      int64        `gorm:"type:int(11);default:0;comment:'数据总数'"`
-	WriteNum      int64        `gorm:"type:int(11);default:0;comment:'已写入数据数量'"`
-	ErrNum        int64        `gorm:"type:int(11);default:0;comment:'错误数据数'"`
-	ErrLogUrl     string       `gorm:"type:text;comment:'错误日志地址'"`
-	DownloadUrl   string       `gorm:"type:text;comment:'文件下载地址'"`
+	Name          string       `gorm:"size:255;comment:任务名称"`
+	Description   string       `gorm:"type:text;comment:描述"`
+	Status        int          `gorm:"size:8;default:1;comment:状态 1-待处理、2-处理中、3-已完成、4-失败、5-任务废弃"`
+	ProgressRate  int          `gorm:"size:8;default:0;comment:任务进度1-100"`
+	StartTime     sql.NullTime `gorm:"comment:任务开始时间"`
+	EndTime       sql.NullTime `gorm:"comment:任务结束时间"`
+	Source        string       `gorm:"size:255;comment:数据源，描述导出数据的来源"`
+	Destination   string       `gorm:"size:255;comment:数据目标，描述导出数据的存储位置"`
+	ExportFormat  string       `gorm:"size:255;comment:导出格式，如CSV、JSON、XML等"`
+	ExportOptions string       `gorm:"type:text;comment:导出选项，可存储导出任务的配置信息（可选）"`
+	QueueKey      string       `gorm:"size:255;comment:队列key"`
+	CountNum      int64        `gorm:"default:0;comment:数据总数"`
+	WriteNum      int64        `gorm:"default:0;comment:已写入数据数量"`
+	ErrNum        int64        `gorm:"default:0;comment:错误数据数"`
+	ErrLogUrl     string       `gorm:"type:text;comment:错误日志地址"`
+	DownloadUrl   string       `gorm:"type:text;comment:文件下载地址"`
 }
 
 // ExportOptions 导出选项
 type ExportOptions struct {
-	FileName string   `json:"file_name"` // 文件名称
-	Header   []string `json:"header"`    // 表头配置
+	FileName    string       `json:"file_name"`              // 文件名称
+	Header      []string     `json:"header"`                 // 表头配置
+	HeaderTree  []HeaderNode `json:"header_tree,omitempty"`  // 多级表头，配置后叶子节点的标题作为表头，xlsx合并分组单元格，其他格式只写入叶子节点
+	Columns     []Column     `json:"columns,omitempty"`      // 列配置，未配置Header时使用列标题作为表头
+	StrictKeys  bool         `json:"strict_keys,omitempty"`  // 对象数据行包含未配置的字段时按错误数据处理
+	SheetName   string       `json:"sheet_name,omitempty"`   // 数据表名称模板，支持{index}、{name}、{date}、{start}、{end}，默认Sheet{index}
+	SheetNames  []string     `json:"sheet_names,omitempty"`  // 各数据表的名称，按序号对应，未配置的数据表使用模板
+	RangeStart  string       `json:"range_start,omitempty"`  // 导出数据范围的开始，如2023-09-01，替换数据表名称模板中的{start}
+	RangeEnd    string       `json:"range_end,omitempty"`    // 导出数据范围的结束，替换数据表名称模板中的{end}
+	PartitionBy string       `json:"partition_by,omitempty"` // 分区列，按该列的值将数据行写入同名数据表，值为表头或对象数据行的字段名
+	Partitions  []string     `json:"partitions,omitempty"`   // 预设分区，每个分区使用单独的队列并按顺序预先创建数据表，未配置时所有分区共用一个队列
+	Csv         *CsvOptions  `json:"csv,omitempty"`          // csv导出选项，导出格式为csv时生效
+	Xlsx        *XlsxOptions `json:"xlsx,omitempty"`         // xlsx导出选项，导出格式为xlsx时生效
 }
 
 type TaskStatus int
@@ -48,49 +58,16 @@ func (s TaskStatus) ParseInt() int {
 	return int(s)
 }
 
-func (m *Task) Create() error {
-	return DbClient.Model(&m).Create(&m).Error
+// isStream 是否为数据总数未知的流式任务，结束前CountNum为UnknownCount
+func (m *Task) isStream() bool {
+	return m.CountNum < 0
 }
 
-func (m *Task) FindByID(id int64) (info Task, err error) {
-	err = DbClient.Model(&m).Where("id = ?", id).First(&info).Error
-	return
-}
-
-func (m *Task) UpdateStatusByID(id int64, status TaskStatus) error {
-	if status == TaskStatusConsult {
-		return DbClient.Model(&m).Where("id = ?", id).UpdateColumns(map[string]interface{}{
-			"status":     status,
-			"start_time": time.Now(),
-		}).Error
-	} else {
-		return DbClient.Model(&m).Where("id = ?", id).UpdateColumn("status", status).Error
+// isFinished 任务是否已结束（完成、失败或废弃）
+func (m *Task) isFinished() bool {
+	switch TaskStatus(m.Status) {
+	case TaskStatusCompleted, TaskStatusFail, TaskStatusAbandon:
+		return true
 	}
-}
-
-func (m *Task) CompleteTaskByID(id int64, writeNum int64) error {
-	return DbClient.Model(&m).Where("id = ?", id).UpdateColumns(map[string]interface{}{
-		"status":        TaskStatusCompleted,
-		"progress_rate": 100,
-		"end_time":      time.Now(),
-		"write_num":     writeNum,
-	}).Error
-}
-
-func (m *Task) FailTaskByID(id int64, errNum, writeNum int64) error {
-	return DbClient.Model(&m).Where("id = ?", id).UpdateColumns(map[string]interface{}{
-		"status":        TaskStatusFail,
-		"progress_rate": 100,
-		"end_time":      time.Now(),
-		"err_num":       errNum,
-		"write_num":     writeNum,
-	}).Error
-}
-
-func (m *Task) UpdateDownloadUrlByID(id int64, url string) error {
-	return DbClient.Model(&m).Where("id = ?", id).UpdateColumn("download_url", url).Error
-}
-
-func (m *Task) UpdateErrLogUrlByID(id int64, url string) error {
-	return DbClient.Model(&m).Where("id = ?", id).UpdateColumn("err_log_url", url).Error
+	return false
 }
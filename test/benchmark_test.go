@@ -0,0 +1,61 @@
+package test
+
+import (
+	"fmt"
+	"github.com/DanPlayer/exportcenter"
+	"github.com/DanPlayer/exportcenter/memqueue"
+	"path/filepath"
+	"testing"
+)
+
+// benchmarkRows 每次导出的数据行数
+const benchmarkRows = 1000
+
+// benchmarkExport 导出benchmarkRows行数据，push负责推送数据
+func benchmarkExport(b *testing.B, push func(center *exportcenter.ExportCenter, id uint, key string)) {
+	center, err := exportcenter.NewClient(exportcenter.Options{
+		Store:        exportcenter.NewMemoryStore(),
+		Queue:        memqueue.New(memqueue.Options{Capacity: benchmarkRows}),
+		SheetMaxRows: benchmarkRows,
+		LogRootPath:  b.TempDir(),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id, keys, err := center.CreateTask("benchmark", "benchmark", "", "", "", "csv", benchmarkRows, exportcenter.ExportOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		push(center, id, keys[0])
+		_ = center.StartTask(int64(id))
+		err = center.Export(int64(id), filepath.Join(dir, fmt.Sprintf("%d.csv", id)), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExportRows(b *testing.B) {
+	benchmarkExport(b, func(center *exportcenter.ExportCenter, id uint, key string) {
+		for i := 0; i < benchmarkRows; i++ {
+			_ = center.PushData(key, fmt.Sprintf(`[%d,"name%d",true]`, i, i))
+		}
+	})
+}
+
+func BenchmarkExportEnvelope(b *testing.B) {
+	benchmarkExport(b, func(center *exportcenter.ExportCenter, id uint, key string) {
+		for seq := 0; seq < benchmarkRows/100; seq++ {
+			rows := make([][]interface{}, 0, 100)
+			for i := seq * 100; i < (seq+1)*100; i++ {
+				rows = append(rows, []interface{}{i, fmt.Sprintf("name%d", i), true})
+			}
+			_ = center.PushEnvelope(key, exportcenter.Envelope{TaskID: int64(id), Seq: int64(seq), Rows: rows})
+		}
+	})
+}
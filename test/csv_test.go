@@ -0,0 +1,237 @@
+package test
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"github.com/DanPlayer/exportcenter"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exportRows 创建任务并推送数据，导出到临时目录，返回任务与导出文件路径
+func exportRows(t *testing.T, center *exportcenter.ExportCenter, format, fileName string, options exportcenter.ExportOptions, rows []string) (exportcenter.Task, string) {
+	id, keys, err := center.CreateTask("test_"+format, "test_name", "", "", "", format, int64(len(rows)), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		// 按数据表顺序推送，每个队列的数据量不超过数据表最大行数
+		if err = center.PushData(keys[i*len(keys)/len(rows)], row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), fileName)
+	err = center.Export(int64(id), filePath, nil)
+	task, e := center.GetTask(int64(id))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if err != nil {
+		t.Fatalf("export: %v (task status %d)", err, task.Status)
+	}
+	return task, task.DownloadUrl
+}
+
+func TestCsvGbkUnsupportedRune(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	// 无法使用GBK编码的行按错误数据处理，不影响其他行
+	task, filePath := exportRows(t, center, "csv", "test.csv", exportcenter.ExportOptions{
+		Header: []string{"名称"},
+		Csv:    &exportcenter.CsvOptions{Encoding: exportcenter.CsvEncodingGbk, LineEnd: "\n"},
+	}, []string{`["中文"]`, `["😀"]`, `["后面"]`})
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.ErrNum != 1 {
+		t.Fatalf("unexpected task: status=%d err_num=%d", task.Status, task.ErrNum)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := simplifiedchinese.GBK.NewEncoder().String("名称\n中文\n后面\n")
+	if string(content) != want {
+		t.Fatalf("got csv %q, want %q", content, want)
+	}
+}
+
+// failSaveWriter 保存时失败的写入器
+type failSaveWriter struct{}
+
+func (w failSaveWriter) Open(filePath string, options exportcenter.ExportOptions) error { return nil }
+func (w failSaveWriter) NewSheet(name string) (exportcenter.SheetWriter, error)         { return w, nil }
+func (w failSaveWriter) WriteRow(values []interface{}) error                            { return nil }
+func (w failSaveWriter) Flush() error                                                   { return nil }
+func (w failSaveWriter) Close() error                                                   { return nil }
+func (w failSaveWriter) Save() (string, error) {
+	return "", errors.New("save failed")
+}
+
+func TestExportSaveFailure(t *testing.T) {
+	exportcenter.RegisterWriter("fail_save", func() exportcenter.Writer { return failSaveWriter{} })
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_fail_save", "test_name", "", "", "", "fail_save", 1, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushData(keys[0], `["a"]`)
+	_ = center.StartTask(int64(id))
+
+	// 保存失败时任务失败，不记录下载地址
+	if err = center.Export(int64(id), filepath.Join(t.TempDir(), "test"), nil); err == nil {
+		t.Fatal("expected save error")
+	}
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusFail.ParseInt() || task.DownloadUrl != "" {
+		t.Fatalf("unexpected task: status=%d download_url=%q", task.Status, task.DownloadUrl)
+	}
+}
+
+func TestCsvOptions(t *testing.T) {
+	rows := []string{`["a,b",1]`, `[" c","x\"y"]`, `["d",null]`}
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("名称,金额\n\"a,b\",1\n\" c\",\"x\"\"y\"\nd,\n")
+	cases := []struct {
+		name    string
+		options exportcenter.CsvOptions
+		want    string
+	}{
+		{
+			name: "default",
+			want: "名称,金额\r\n\"a,b\",1\r\n\" c\",\"x\"\"y\"\r\nd,\r\n",
+		},
+		{
+			name:    "delimiter_quote_all",
+			options: exportcenter.CsvOptions{Delimiter: ";", Quote: exportcenter.CsvQuoteAll, LineEnd: "\n"},
+			want:    "\"名称\";\"金额\"\n\"a,b\";\"1\"\n\" c\";\"x\"\"y\"\n\"d\";\"\"\n",
+		},
+		{
+			name:    "non_numeric_bom",
+			options: exportcenter.CsvOptions{Quote: exportcenter.CsvQuoteNonNumeric, Bom: true},
+			want:    "\xEF\xBB\xBF\"名称\",\"金额\"\r\n\"a,b\",1\r\n\" c\",\"x\"\"y\"\r\n\"d\",\"\"\r\n",
+		},
+		{
+			name:    "tab_delimiter",
+			options: exportcenter.CsvOptions{Delimiter: "\t", LineEnd: "\n"},
+			want:    "名称\t金额\na,b\t1\n\" c\"\t\"x\"\"y\"\nd\t\n",
+		},
+		{
+			// GBK编码时不写入BOM
+			name:    "gbk",
+			options: exportcenter.CsvOptions{Encoding: exportcenter.CsvEncodingGbk, Bom: true, LineEnd: "\n"},
+			want:    gbk,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			center := newMemoryCenter(t, 10)
+			options := c.options
+			_, filePath := exportRows(t, center, "csv", "test.csv", exportcenter.ExportOptions{
+				Header: []string{"名称", "金额"},
+				Csv:    &options,
+			}, rows)
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != c.want {
+				t.Fatalf("got csv %q, want %q", content, c.want)
+			}
+		})
+	}
+}
+
+func TestCsvZipRollover(t *testing.T) {
+	center := newMemoryCenter(t, 2)
+
+	// 超过数据表最大行数时每个数据表写入单独的csv，打包成zip
+	_, filePath := exportRows(t, center, "csv", "orders.csv", exportcenter.ExportOptions{
+		Header: []string{"名称"},
+		Csv:    &exportcenter.CsvOptions{LineEnd: "\n"},
+	}, []string{`["a"]`, `["b"]`, `["c"]`})
+	if filepath.Base(filePath) != "orders.zip" {
+		t.Fatalf("got file %s, want orders.zip", filePath)
+	}
+
+	// zip中的文件以数据表名称命名
+	want := map[string]string{
+		"Sheet1.csv": "名称\na\nb\n",
+		"Sheet2.csv": "名称\nc\n",
+	}
+	if got := readZip(t, filePath); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got zip entries %q, want %q", got, want)
+	}
+
+	// 分片文件已删除
+	parts, _ := filepath.Glob(filepath.Join(filepath.Dir(filePath), "*.part*"))
+	if len(parts) != 0 {
+		t.Fatalf("part files left: %v", parts)
+	}
+}
+
+func TestCsvZipEntryNames(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	// 分区数据表名称作为zip中的文件名，替换文件名不允许的字符后重名时增加序号
+	_, filePath := exportRows(t, center, "csv", "regions.csv", exportcenter.ExportOptions{
+		Header:      []string{"区域"},
+		PartitionBy: "区域",
+		Csv:         &exportcenter.CsvOptions{LineEnd: "\n"},
+	}, []string{`["华东"]`, `["a<b"]`, `["a>b"]`, `["华东"]`, `[""]`})
+	want := map[string]string{
+		"华东.csv":      "区域\n华东\n华东\n",
+		"a_b.csv":     "区域\na<b\n",
+		"a_b (2).csv": "区域\na>b\n",
+		"Sheet4.csv":  "区域\n\n",
+	}
+	if got := readZip(t, filePath); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got zip entries %q, want %q", got, want)
+	}
+
+	// 配置的数据表名称同样作为文件名
+	_, filePath = exportRows(t, newMemoryCenter(t, 1), "csv", "orders.csv", exportcenter.ExportOptions{
+		SheetNames: []string{"2023/09 订单", "退款|明细"},
+		Csv:        &exportcenter.CsvOptions{LineEnd: "\n"},
+	}, []string{`[1]`, `[2]`})
+	want = map[string]string{
+		"2023_09 订单.csv": "1\n",
+		"退款_明细.csv":      "2\n",
+	}
+	if got := readZip(t, filePath); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got zip entries %q, want %q", got, want)
+	}
+}
+
+// readZip 读取zip中所有文件的内容
+func readZip(t *testing.T, filePath string) map[string]string {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	files := make(map[string]string, len(reader.File))
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = string(content)
+	}
+	return files
+}
@@ -0,0 +1,1025 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DanPlayer/exportcenter"
+	"github.com/DanPlayer/exportcenter/memqueue"
+	"github.com/xuri/excelize/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMemoryCenter 使用内存任务存储与内存队列创建导出中心，不依赖外部服务
+func newMemoryCenter(t *testing.T, sheetMaxRows int64) *exportcenter.ExportCenter {
+	return newMemoryCenterWithOptions(t, exportcenter.Options{SheetMaxRows: sheetMaxRows})
+}
+
+func newMemoryCenterWithOptions(t *testing.T, options exportcenter.Options) *exportcenter.ExportCenter {
+	options.Store = exportcenter.NewMemoryStore()
+	options.Queue = memqueue.New(memqueue.Options{})
+	options.PoolMax = 2
+	options.GoroutineMax = 30
+	options.LogRootPath = t.TempDir()
+	if options.OutTime == 0 {
+		options.OutTime = 500 * time.Millisecond
+	}
+	center, err := exportcenter.NewClient(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return center
+}
+
+func TestMemoryTaskExport(t *testing.T) {
+	center := newMemoryCenter(t, 2)
+
+	id, keys, err := center.CreateTask(
+		"test_memory",
+		"test_name",
+		"test_file",
+		"测试使用",
+		"本地处理的数据",
+		"xlsx",
+		3,
+		exportcenter.ExportOptions{
+			Header: []string{"header1", "header2", "header3"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d queue keys, want 2", len(keys))
+	}
+
+	row := 0
+	for i, key := range keys {
+		for j := 0; j < 2-i; j++ {
+			row++
+			err = center.PushData(key, fmt.Sprintf("[\"name%d\",%d,true]", row, row))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err = center.StartTask(int64(id)); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	err = center.Export(int64(id), filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.WriteNum != 3 || task.DownloadUrl != filePath {
+		t.Fatalf("unexpected task: status=%d write_num=%d download_url=%s", task.Status, task.WriteNum, task.DownloadUrl)
+	}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if sheets := f.GetSheetList(); len(sheets) != 2 {
+		t.Fatalf("got sheets %v, want 2 sheets", sheets)
+	}
+	rows, err := f.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "header1" || rows[1][0] != "name1" || rows[2][1] != "2" {
+		t.Fatalf("unexpected Sheet1 rows: %v", rows)
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, _, err := center.CreateTask("test_cancel", "test_name", "", "", "", "jsonl", 5, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "test.jsonl")
+	exported := make(chan error, 1)
+	go func() {
+		exported <- center.Export(int64(id), filePath, nil)
+	}()
+
+	// 等待开启信号时取消
+	time.Sleep(50 * time.Millisecond)
+	if err = center.CancelTask(int64(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-exported; !errors.Is(err, exportcenter.ErrTaskCanceled) {
+		t.Fatalf("export returned %v, want ErrTaskCanceled", err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusAbandon.ParseInt() || !task.EndTime.Valid {
+		t.Fatalf("unexpected task: status=%d end_time=%v", task.Status, task.EndTime)
+	}
+	if _, err = os.Stat(filePath); !os.IsNotExist(err) {
+		t.Fatalf("partial file was not removed: %v", err)
+	}
+	if err = center.CancelTask(int64(id)); !errors.Is(err, exportcenter.ErrTaskFinished) {
+		t.Fatalf("cancel abandoned task returned %v, want ErrTaskFinished", err)
+	}
+}
+
+func TestCancelConsumingTask(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_cancel", "test_name", "", "", "", "jsonl", 5, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushData(keys[0], "[1]")
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.jsonl")
+	exported := make(chan error, 1)
+	go func() {
+		exported <- center.Export(int64(id), filePath, nil)
+	}()
+
+	// 消费数据时取消
+	time.Sleep(100 * time.Millisecond)
+	if err = center.CancelTask(int64(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-exported; !errors.Is(err, exportcenter.ErrTaskCanceled) {
+		t.Fatalf("export returned %v, want ErrTaskCanceled", err)
+	}
+	if _, err = os.Stat(filePath); !os.IsNotExist(err) {
+		t.Fatalf("partial file was not removed: %v", err)
+	}
+	if err = center.PushData(keys[0], "[2]"); !errors.Is(err, memqueue.ErrQueueNotFound) {
+		t.Fatalf("queue was not destroyed: %v", err)
+	}
+}
+
+// openQueue 销毁队列时不关闭数据通道，模拟BRPOP等销毁后不会唤醒消费者的队列
+type openQueue struct {
+	*memqueue.MemQueue
+}
+
+func (q *openQueue) Destroy(ctx context.Context, key string) error {
+	return nil
+}
+
+func TestCancelTaskInOtherProcess(t *testing.T) {
+	cases := map[string]int64{"stream": exportcenter.UnknownCount, "wait_close": 5}
+	for name, count := range cases {
+		t.Run(name, func(t *testing.T) {
+			// 接口服务与导出服务共享任务存储、队列与开启信号
+			options := exportcenter.Options{
+				Store:            exportcenter.NewMemoryStore(),
+				Queue:            &openQueue{MemQueue: memqueue.New(memqueue.Options{})},
+				Signaler:         exportcenter.NewMemorySignaler(),
+				SheetMaxRows:     10,
+				LogRootPath:      t.TempDir(),
+				OutTime:          20 * time.Millisecond,
+				WaitClose:        true,
+				ProgressInterval: 20 * time.Millisecond,
+			}
+			api, err := exportcenter.NewClient(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			worker, err := exportcenter.NewClient(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id, keys, err := api.CreateTask("test_cancel_"+name, "test_name", "", "", "", "jsonl", count, exportcenter.ExportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = api.PushData(keys[0], "[1]")
+			_ = api.StartTask(int64(id))
+
+			filePath := filepath.Join(t.TempDir(), "test.jsonl")
+			exported := make(chan error, 1)
+			go func() {
+				exported <- worker.Export(int64(id), filePath, nil)
+			}()
+
+			time.Sleep(100 * time.Millisecond)
+			if err = api.CancelTask(int64(id)); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err = <-exported:
+				if !errors.Is(err, exportcenter.ErrTaskCanceled) {
+					t.Fatalf("export returned %v, want ErrTaskCanceled", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("export did not stop after the task was cancelled in another process")
+			}
+
+			task, _ := api.GetTask(int64(id))
+			if task.Status != exportcenter.TaskStatusAbandon.ParseInt() {
+				t.Fatalf("task status is %d, want abandon", task.Status)
+			}
+			if _, err = os.Stat(filePath); !os.IsNotExist(err) {
+				t.Fatalf("partial file was not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloseQueue(t *testing.T) {
+	center := newMemoryCenterWithOptions(t, exportcenter.Options{
+		SheetMaxRows: 100,
+		OutTime:      20 * time.Millisecond,
+		WaitClose:    true,
+	})
+
+	// 创建任务时数据量只是预估值，以结束标记为准
+	id, keys, err := center.CreateTask("test_close", "test_name", "", "", "", "csv", 10, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.StartTask(int64(id))
+
+	// 生产者推送数据的间隔超过OutTime
+	go func() {
+		for i := 1; i <= 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+			_ = center.PushData(keys[0], fmt.Sprintf("[%d]", i))
+		}
+		_ = center.CloseQueue(keys[0])
+	}()
+
+	err = center.Export(int64(id), filepath.Join(t.TempDir(), "test.csv"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.WriteNum != 3 {
+		t.Fatalf("unexpected task: status=%d write_num=%d", task.Status, task.WriteNum)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		count   int64
+		options exportcenter.Options
+		export  exportcenter.ExportOptions
+	}{
+		// 未开启WaitClose时流式任务的最长空闲时间为OutTime
+		{name: "stream", count: exportcenter.UnknownCount, options: exportcenter.Options{OutTime: 100 * time.Millisecond}},
+		{name: "wait_close", count: 10, options: exportcenter.Options{OutTime: 20 * time.Millisecond, WaitClose: true, IdleTimeout: 100 * time.Millisecond}},
+		{name: "partition_stream", count: exportcenter.UnknownCount, options: exportcenter.Options{OutTime: 100 * time.Millisecond},
+			export: exportcenter.ExportOptions{Header: []string{"区域"}, PartitionBy: "区域"}},
+		{name: "partition_wait_close", count: 10, options: exportcenter.Options{OutTime: 20 * time.Millisecond, WaitClose: true, IdleTimeout: 100 * time.Millisecond},
+			export: exportcenter.ExportOptions{Header: []string{"区域"}, PartitionBy: "区域", Partitions: []string{"华东", "华南"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.options.SheetMaxRows = 10
+			center := newMemoryCenterWithOptions(t, c.options)
+
+			id, keys, err := center.CreateTask("test_idle_"+c.name, "test_name", "", "", "", "csv", c.count, c.export)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 生产者推送部分数据后异常退出，没有推送结束标记
+			_ = center.PushData(keys[0], `["华东"]`)
+			_ = center.StartTask(int64(id))
+
+			exported := make(chan error, 1)
+			go func() {
+				exported <- center.Export(int64(id), filepath.Join(t.TempDir(), "test.csv"), nil)
+			}()
+			select {
+			case err = <-exported:
+				if !errors.Is(err, exportcenter.ErrIdleTimeout) {
+					t.Fatalf("export returned %v, want ErrIdleTimeout", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("export did not fail after the queue was idle")
+			}
+
+			task, _ := center.GetTask(int64(id))
+			if task.Status != exportcenter.TaskStatusFail.ParseInt() || task.DownloadUrl != "" {
+				t.Fatalf("unexpected task: status=%d download_url=%q", task.Status, task.DownloadUrl)
+			}
+			// 任务失败后销毁队列
+			for _, key := range keys {
+				if err = center.PushData(key, `["华东"]`); !errors.Is(err, memqueue.ErrQueueNotFound) {
+					t.Fatalf("queue %s was not destroyed: %v", key, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCloseQueueFullSheet(t *testing.T) {
+	for _, waitClose := range []bool{false, true} {
+		t.Run(fmt.Sprintf("wait_close_%t", waitClose), func(t *testing.T) {
+			center := newMemoryCenterWithOptions(t, exportcenter.Options{
+				SheetMaxRows: 2,
+				OutTime:      100 * time.Millisecond,
+				WaitClose:    waitClose,
+			})
+
+			// 数据量为预估值，写满的数据表不再读取结束标记，所有队列结束时任务完成
+			id, keys, err := center.CreateTask("test_close_full", "test_name", "", "", "", "csv", 4, exportcenter.ExportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = center.PushData(keys[0], "[1]")
+			_ = center.PushData(keys[0], "[2]")
+			_ = center.CloseQueue(keys[0])
+			_ = center.PushData(keys[1], "[3]")
+			_ = center.CloseQueue(keys[1])
+			_ = center.StartTask(int64(id))
+
+			if err = center.Export(int64(id), filepath.Join(t.TempDir(), "test.csv"), nil); err != nil {
+				t.Fatal(err)
+			}
+			task, _ := center.GetTask(int64(id))
+			if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.WriteNum != 3 || task.ErrNum != 0 {
+				t.Fatalf("unexpected task: status=%d write_num=%d err_num=%d", task.Status, task.WriteNum, task.ErrNum)
+			}
+		})
+	}
+}
+
+func TestStreamTaskExport(t *testing.T) {
+	center := newMemoryCenter(t, 2)
+
+	id, keys, err := center.CreateTask("test_stream", "test_name", "", "", "", "xlsx", exportcenter.UnknownCount, exportcenter.ExportOptions{
+		Header: []string{"header1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("got %d queue keys, want 1", len(keys))
+	}
+
+	// 内存队列不支持批量推送，逐条推送
+	data := make([]string, 0, 5)
+	for i := 1; i <= 5; i++ {
+		data = append(data, fmt.Sprintf("[%d]", i))
+	}
+	if err = center.PushBatch(keys[0], data); err != nil {
+		t.Fatal(err)
+	}
+	_ = center.CloseQueue(keys[0])
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	err = center.Export(int64(id), filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.CountNum != 5 || task.WriteNum != 5 {
+		t.Fatalf("unexpected task: status=%d count_num=%d write_num=%d", task.Status, task.CountNum, task.WriteNum)
+	}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if sheets := f.GetSheetList(); len(sheets) != 3 {
+		t.Fatalf("got sheets %v, want 3 sheets", sheets)
+	}
+	rows, _ := f.GetRows("Sheet3")
+	if len(rows) != 2 || rows[1][0] != "5" {
+		t.Fatalf("unexpected Sheet3 rows: %v", rows)
+	}
+}
+
+func TestDestroyedQueueStopsExport(t *testing.T) {
+	cases := map[string]int64{"stream": exportcenter.UnknownCount, "wait_close": 10}
+	for name, count := range cases {
+		t.Run(name, func(t *testing.T) {
+			center := newMemoryCenterWithOptions(t, exportcenter.Options{SheetMaxRows: 10, WaitClose: true})
+			id, keys, err := center.CreateTask("test_destroyed", "test_name", "", "", "", "csv", count, exportcenter.ExportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = center.PushData(keys[0], `["a"]`)
+			_ = center.StartTask(int64(id))
+
+			exported := make(chan error, 1)
+			go func() {
+				exported <- center.Export(int64(id), filepath.Join(t.TempDir(), "test.csv"), nil)
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			// 队列销毁后导出协程退出，不把关闭的通道当作数据
+			_ = center.Queue.Destroy(context.Background(), keys[0])
+			select {
+			case <-exported:
+			case <-time.After(2 * time.Second):
+				t.Fatal("export did not stop after the queue was destroyed")
+			}
+			task, err := center.GetTask(int64(id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task.Status != exportcenter.TaskStatusFail.ParseInt() || task.WriteNum != 1 || task.ErrNum != 0 {
+				t.Fatalf("unexpected task: status=%d write_num=%d err_num=%d", task.Status, task.WriteNum, task.ErrNum)
+			}
+		})
+	}
+}
+
+// rejectQueue 记录确认与拒绝数据的内存队列
+type rejectQueue struct {
+	*memqueue.MemQueue
+	lock     sync.Mutex
+	acked    []string
+	rejected map[string]error
+}
+
+func (q *rejectQueue) Ack(ctx context.Context, key, data string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.acked = append(q.acked, data)
+	return nil
+}
+
+func (q *rejectQueue) Reject(ctx context.Context, key, data string, reason error) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.rejected[data] = reason
+	return nil
+}
+
+func TestRejectUnparsableRow(t *testing.T) {
+	queue := &rejectQueue{MemQueue: memqueue.New(memqueue.Options{}), rejected: make(map[string]error)}
+	center, err := exportcenter.NewClient(exportcenter.Options{
+		Store:        exportcenter.NewMemoryStore(),
+		Queue:        queue,
+		SheetMaxRows: 10,
+		LogRootPath:  t.TempDir(),
+		OutTime:      500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, keys, err := center.CreateTask("test_reject", "test_name", "", "", "", "jsonl", 4, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 开头的空白字符忽略，数组与对象以外的数据按错误数据拒绝
+	_ = center.PushData(keys[0], "[1]")
+	_ = center.PushData(keys[0], " \n[2]")
+	_ = center.PushData(keys[0], "{bad")
+	_ = center.PushData(keys[0], `"abc"`)
+	_ = center.StartTask(int64(id))
+
+	_ = center.Export(int64(id), filepath.Join(t.TempDir(), "test.jsonl"), nil)
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.WriteNum != 4 || task.ErrNum != 2 {
+		t.Fatalf("unexpected task: write_num=%d err_num=%d", task.WriteNum, task.ErrNum)
+	}
+	if len(queue.acked) != 2 || queue.acked[0] != "[1]" || queue.acked[1] != " \n[2]" {
+		t.Fatalf("unexpected acked rows: %v", queue.acked)
+	}
+	for _, data := range []string{"{bad", `"abc"`} {
+		if reason, ok := queue.rejected[data]; !ok || reason == nil {
+			t.Fatalf("unparsable row %q was not rejected: %v", data, queue.rejected)
+		}
+	}
+}
+
+func TestEnvelopeExport(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_envelope", "test_name", "", "", "", "csv", 5, exportcenter.ExportOptions{
+		Header: []string{"id", "name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 多行消息与单行数据可以混合推送，任务ID不一致的多行消息整体拒绝
+	_ = center.PushEnvelope(keys[0], exportcenter.Envelope{TaskID: int64(id), Seq: 1, Rows: [][]interface{}{{1, "a"}, {2, "b"}, {3, "c"}}})
+	_ = center.PushData(keys[0], `[4,"d"]`)
+	_ = center.PushEnvelope(keys[0], exportcenter.Envelope{TaskID: int64(id) + 1, Seq: 2, Rows: [][]interface{}{{5, "e"}}})
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.WriteNum != 5 || task.ErrNum != 1 {
+		t.Fatalf("unexpected task: write_num=%d err_num=%d", task.WriteNum, task.ErrNum)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,name\r\n1,a\r\n2,b\r\n3,c\r\n4,d\r\n"; string(content) != want {
+		t.Fatalf("got csv %q, want %q", content, want)
+	}
+}
+
+type exportBase struct {
+	ID int64 `export:"header=编号,order=1"`
+}
+
+type exportOrder struct {
+	exportBase
+	Amount    float64    `export:"header=金额,order=3,format=%.2f"`
+	Name      string     `export:"header=名称,order=2"`
+	PaidAt    *time.Time `export:"header=支付时间,format=Jan 2, 2006"` // format之后的逗号属于格式
+	Remark    string
+	internal  string
+	CreatedBy string `export:"-"`
+}
+
+func TestPushRows(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	header, err := exportcenter.HeaderOf[exportOrder]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"编号", "名称", "金额", "支付时间", "Remark"}; fmt.Sprint(header) != fmt.Sprint(want) {
+		t.Fatalf("got header %v, want %v", header, want)
+	}
+
+	id, keys, err := exportcenter.CreateTaskFor[exportOrder](center, "test_rows", "test_name", "", "", "", "csv", 2, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paidAt := time.Date(2023, 9, 1, 10, 0, 0, 0, time.Local)
+	err = exportcenter.PushRows(center, keys[0], []exportOrder{
+		{exportBase: exportBase{ID: 1}, Amount: 9.5, Name: "a", PaidAt: &paidAt, Remark: "r", internal: "x", CreatedBy: "u"},
+		{exportBase: exportBase{ID: 2}, Amount: 10, Name: "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "编号,名称,金额,支付时间,Remark\r\n1,a,9.50,\"Sep 1, 2023\",r\r\n2,b,10.00,,\r\n"; string(content) != want {
+		t.Fatalf("got csv %q, want %q", content, want)
+	}
+
+	if _, err = exportcenter.HeaderOf[string](); !errors.Is(err, exportcenter.ErrNotStruct) {
+		t.Fatalf("HeaderOf[string] returned %v, want ErrNotStruct", err)
+	}
+}
+
+func TestObjectRowExport(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_object", "test_name", "", "", "", "csv", 5, exportcenter.ExportOptions{
+		Columns: []exportcenter.Column{
+			{Header: "名称", Key: "name"},
+			{Header: "金额", Key: "amount"},
+			{Header: "remark"},
+		},
+		StrictKeys: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按字段名写入对应的列，缺少的字段为空，开启StrictKeys时未配置的字段按错误数据处理
+	_ = center.PushData(keys[0], `{"amount":9.5,"name":"a","remark":"r"}`)
+	_ = center.PushData(keys[0], `{"name":"b"}`)
+	_ = center.PushData(keys[0], `{"name":"c","unknown":1}`)
+	_ = center.PushData(keys[0], `["d",1,""]`)
+	_ = center.PushData(keys[0], "\n\t{\"name\":\"e\"}")
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.WriteNum != 5 || task.ErrNum != 1 {
+		t.Fatalf("unexpected task: write_num=%d err_num=%d", task.WriteNum, task.ErrNum)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "名称,金额,remark\r\na,9.5,r\r\nb,,\r\nd,1,\r\ne,,\r\n"; string(content) != want {
+		t.Fatalf("got csv %q, want %q", content, want)
+	}
+}
+
+func TestTypedColumnExport(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_typed", "test_name", "", "", "", "xlsx", 2, exportcenter.ExportOptions{
+		Columns: []exportcenter.Column{
+			{Header: "编号", Type: exportcenter.ColumnInt, Width: 24},
+			{Header: "金额", Type: exportcenter.ColumnDecimal, NumFmt: "#,##0.00", Align: exportcenter.AlignRight},
+			{Header: "日期", Type: exportcenter.ColumnDate},
+			{Header: "比例", Type: exportcenter.ColumnPercent},
+			{Header: "启用", Type: exportcenter.ColumnBool},
+			{Header: "备注"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushData(keys[0], `[1234567890123456789,"1234.5","2023-09-01",0.125,"true",12345678901234567]`)
+	// 无法转换的数据按错误数据处理
+	_ = center.PushData(keys[0], `["abc",1,"2023-09-01",0,true,""]`)
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.WriteNum != 2 || task.ErrNum != 1 {
+		t.Fatalf("unexpected task: write_num=%d err_num=%d", task.WriteNum, task.ErrNum)
+	}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 长整数不丢失精度，数字与日期按格式显示，未配置类型的长整数按文本写入
+	want := []string{"1234567890123456789", "1,234.50", "2023-09-01", "12.50%", "TRUE", "12345678901234567"}
+	if len(rows) != 2 || fmt.Sprint(rows[1]) != fmt.Sprint(want) {
+		t.Fatalf("got rows %v, want %v", rows, want)
+	}
+	if cellType, _ := f.GetCellType("Sheet1", "C2"); cellType != excelize.CellTypeNumber && cellType != excelize.CellTypeUnset {
+		t.Fatalf("date cell type %v, want number", cellType)
+	}
+	if width, _ := f.GetColWidth("Sheet1", "A"); width != 24 {
+		t.Fatalf("got column width %v, want 24", width)
+	}
+}
+
+func TestUntypedLongNumbers(t *testing.T) {
+	rows := []string{`[123456789012,100000000000,12345678901234567890,1234.5]`}
+
+	// csv与jsonl未配置类型时保留解析的数字，长整数不丢失精度
+	center := newMemoryCenter(t, 10)
+	_, filePath := exportRows(t, center, "jsonl", "test.jsonl", exportcenter.ExportOptions{}, rows)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[123456789012,100000000000,12345678901234567890,1234.5]\n"; string(content) != want {
+		t.Fatalf("got jsonl %q, want %q", content, want)
+	}
+
+	_, filePath = exportRows(t, center, "csv", "test.csv", exportcenter.ExportOptions{}, rows)
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "123456789012,100000000000,12345678901234567890,1234.5\r\n"; string(content) != want {
+		t.Fatalf("got csv %q, want %q", content, want)
+	}
+
+	// xlsx未配置类型的列超过11位的整数按文本写入，配置类型的列按类型写入
+	_, filePath = exportRows(t, center, "xlsx", "test.xlsx", exportcenter.ExportOptions{
+		Columns: []exportcenter.Column{{Header: "编号", Type: exportcenter.ColumnInt}, {Header: "数量"}, {Header: "流水号"}, {Header: "金额"}},
+	}, rows)
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := map[string]string{"A2": "123456789012", "B2": "100000000000", "C2": "12345678901234567890", "D2": "1234.5"}
+	numbers := map[string]bool{"A2": true, "D2": true}
+	for cell, value := range want {
+		got, _ := f.GetCellValue("Sheet1", cell)
+		if got != value {
+			t.Fatalf("cell %s is %q, want %q", cell, got, value)
+		}
+		cellType, _ := f.GetCellType("Sheet1", cell)
+		isNumber := cellType == excelize.CellTypeNumber || cellType == excelize.CellTypeUnset
+		if isNumber != numbers[cell] {
+			t.Fatalf("cell %s type is %v, want number %v", cell, cellType, numbers[cell])
+		}
+	}
+}
+
+func TestXlsxSheetOptions(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_xlsx_options", "test_name", "", "", "", "xlsx", 3, exportcenter.ExportOptions{
+		Header: []string{"编号", "名称", "备注"},
+		Xlsx: &exportcenter.XlsxOptions{
+			HeaderStyle:  &exportcenter.HeaderStyle{Bold: true, FillColor: "#D9D9D9", Border: true},
+			FreezeHeader: true,
+			FreezeCols:   1,
+			AutoFilter:   true,
+			AutoFit:      true,
+			ColWidth:     15,
+		},
+		Columns: []exportcenter.Column{{Header: "编号"}, {Header: "名称"}, {Header: "备注", Width: 30}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushBatch(keys[0], []string{`[1,"name1"]`, `[2,"一个很长的名称"]`, `[3,"name3"]`})
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got rows %v, want header and 3 rows", rows)
+	}
+
+	styleID, err := f.GetCellStyle("Sheet1", "B1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := f.GetStyle(styleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style.Font == nil || !style.Font.Bold || len(style.Border) != 4 {
+		t.Fatalf("unexpected header style %+v", style)
+	}
+
+	panes, err := f.GetPanes("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !panes.Freeze || panes.XSplit != 1 || panes.YSplit != 1 || panes.TopLeftCell != "B2" {
+		t.Fatalf("unexpected panes %+v", panes)
+	}
+
+	var filter string
+	for _, name := range f.GetDefinedName() {
+		if name.Name == "_xlnm._FilterDatabase" {
+			filter = name.RefersTo
+		}
+	}
+	if filter != "'Sheet1'!$A$1:$C$4" {
+		t.Fatalf("got filter %q", filter)
+	}
+
+	// 自动列宽按最宽的内容计算，列配置的宽度优先
+	widths := map[string]float64{"A": 6, "B": 16, "C": 30}
+	for col, want := range widths {
+		if width, _ := f.GetColWidth("Sheet1", col); width != want {
+			t.Fatalf("got column %s width %v, want %v", col, width, want)
+		}
+	}
+}
+
+func TestHeaderTreeExport(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, keys, err := center.CreateTask("test_header_tree", "test_name", "", "", "", "xlsx", 1, exportcenter.ExportOptions{
+		HeaderTree: []exportcenter.HeaderNode{
+			{Title: "门店"},
+			{Title: "2023", Children: []exportcenter.HeaderNode{
+				{Title: "Q1", Children: []exportcenter.HeaderNode{{Title: "收入"}, {Title: "成本"}, {Title: "利润"}}},
+				{Title: "Q2"},
+			}},
+		},
+		Xlsx: &exportcenter.XlsxOptions{FreezeHeader: true, AutoFilter: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushData(keys[0], `["store1",10,6,4,8]`)
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"门店", "2023"},
+		{"", "Q1", "", "", "Q2"},
+		{"", "收入", "成本", "利润"},
+		{"store1", "10", "6", "4", "8"},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("got rows %v, want %v", rows, want)
+	}
+
+	merges, err := f.GetMergeCells("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []string
+	for _, merge := range merges {
+		refs = append(refs, merge.GetStartAxis()+":"+merge.GetEndAxis())
+	}
+	sort.Strings(refs)
+	if want := "[A1:A3 B1:E1 B2:D2 E2:E3]"; fmt.Sprint(refs) != want {
+		t.Fatalf("got merges %v, want %s", refs, want)
+	}
+
+	panes, err := f.GetPanes("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if panes.YSplit != 3 || panes.TopLeftCell != "A4" {
+		t.Fatalf("unexpected panes %+v", panes)
+	}
+}
+
+func TestSheetNames(t *testing.T) {
+	center := newMemoryCenter(t, 1)
+
+	name := "2023/09/01-2023/09/30 Orders Report"
+	id, sheets, err := center.CreateTaskWithSheets("test_sheet_names", name, "", "", "", "xlsx", 3, exportcenter.ExportOptions{
+		Header:     []string{"名称"},
+		SheetName:  "{name} {index}",
+		SheetNames: []string{"华东:上海", "华东?上海"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 替换不允许的字符，重名增加序号，超过31个字符截断
+	want := []string{"华东_上海", "华东_上海 (2)", "2023_09_01-2023_09_30 Orders Re"}
+	if len(sheets) != len(want) {
+		t.Fatalf("got sheets %v, want %v", sheets, want)
+	}
+	for i, sheet := range sheets {
+		if sheet.Name != want[i] {
+			t.Fatalf("got sheet name %q, want %q", sheet.Name, want[i])
+		}
+		_ = center.PushData(sheet.Key, fmt.Sprintf(`["name%d"]`, i+1))
+	}
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := f.GetSheetList(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got sheets %v, want %v", got, want)
+	}
+	for i, sheet := range want {
+		rows, _ := f.GetRows(sheet)
+		if len(rows) != 2 || rows[1][0] != fmt.Sprintf("name%d", i+1) {
+			t.Fatalf("got sheet %s rows %v", sheet, rows)
+		}
+	}
+
+	// 按导出选项的数据范围命名
+	_, sheets, err = center.CreateTaskWithSheets("test_sheet_range", name, "", "", "", "xlsx", 2, exportcenter.ExportOptions{
+		Header:     []string{"名称"},
+		SheetName:  "{start}~{end} {index}",
+		RangeStart: "2023-09-01",
+		RangeEnd:   "2023-09-15",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 2 || sheets[0].Name != "2023-09-01~2023-09-15 1" || sheets[1].Name != "2023-09-01~2023-09-15 2" {
+		t.Fatalf("unexpected sheets %v", sheets)
+	}
+}
+
+func TestPartitionExport(t *testing.T) {
+	center := newMemoryCenter(t, 2)
+
+	options := exportcenter.ExportOptions{
+		Header:      []string{"区域", "门店"},
+		PartitionBy: "区域",
+		Partitions:  []string{"华东", "华南"},
+	}
+	id, sheets, err := center.CreateTaskWithSheets("test_partition", "test_name", "", "", "", "xlsx", 5, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 2 || sheets[0].Name != "华东" || sheets[1].Name != "华南" {
+		t.Fatalf("unexpected sheets %v", sheets)
+	}
+
+	// 数据行按分区列的值写入数据表，与推送的队列无关
+	_ = center.PushBatch(sheets[0].Key, []string{`["华东","s1"]`, `["华东","s2"]`, `["华东","s3"]`, `["华北","s4"]`})
+	_ = center.PushData(sheets[1].Key, `["华南","s5"]`)
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.WriteNum != 5 {
+		t.Fatalf("unexpected task: status=%d write_num=%d", task.Status, task.WriteNum)
+	}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// 预设分区按顺序创建，超过最大行数的分区新增数据表
+	want := map[string]string{
+		"华东":     "[[区域 门店] [华东 s1] [华东 s2]]",
+		"华南":     "[[区域 门店] [华南 s5]]",
+		"华东 (2)": "[[区域 门店] [华东 s3]]",
+		"华北":     "[[区域 门店] [华北 s4]]",
+	}
+	if got := f.GetSheetList(); fmt.Sprint(got) != "[华东 华南 华东 (2) 华北]" {
+		t.Fatalf("got sheets %v", got)
+	}
+	for sheet, rows := range want {
+		got, _ := f.GetRows(sheet)
+		if fmt.Sprint(got) != rows {
+			t.Fatalf("got sheet %s rows %v, want %s", sheet, got, rows)
+		}
+	}
+
+	options.PartitionBy = "城市"
+	if _, _, err = center.CreateTask("test_partition", "test_name", "", "", "", "xlsx", 1, options); err == nil {
+		t.Fatal("expected unknown partition column error")
+	}
+}
@@ -34,11 +34,23 @@ func main(m *testing.M) {
 
 func TestRabbitMqTaskExport(t *testing.T) {
 	getWd, _ := os.Getwd()
+	// 连接mq，连接断开后自动重连
+	mq, err := rabbitmq.NewRabbitMQ(rabbitmq.Options{
+		UserName: "guest",
+		Password: "guest",
+		Host:     "127.0.0.1",
+		Vhost:    "/",
+	})
+	if err != nil {
+		return
+	}
+	defer mq.Close()
+
 	// 开启导出中心
 	center, err := exportcenter.NewClient(exportcenter.Options{
 		Db:           db,                                 // 数据库实例
 		QueuePrefix:  "ec_",                              // 队列前缀
-		Queue:        rabbitmq.Client,                    // 使用mq队列
+		Queue:        mq,                                 // 使用mq队列
 		SheetMaxRows: 500000,                             // 表格最大接收行数
 		PoolMax:      2,                                  // 最大并发池
 		GoroutineMax: 30,                                 // 最大协程数
@@ -80,14 +92,8 @@ func TestRabbitMqTaskExport(t *testing.T) {
 
 	center.StartTask(int64(id))
 
-	err = center.ExportToExcel(int64(id), "./test.xlsx", func(key string) error {
-		// 重新开启消费者
-		err := rabbitmq.Client.DeclareConsume(key)
-		if err != nil {
-			fmt.Println(err)
-		}
-		return nil
-	})
+	// 首次拉取数据时自动声明消费者，写入数据后手动应答
+	err = center.ExportToExcel(int64(id), "./test.xlsx", nil)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/DanPlayer/exportcenter/memqueue"
+	"testing"
+	"time"
+)
+
+func TestMemQueue(t *testing.T) {
+	ctx := context.Background()
+	queue := memqueue.New(memqueue.Options{Capacity: 2})
+
+	if err := queue.Push(ctx, "test", "data"); !errors.Is(err, memqueue.ErrQueueNotFound) {
+		t.Fatalf("push to missing queue: %v", err)
+	}
+
+	err := queue.CreateQueue(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 先进先出
+	for _, datum := range []string{"1", "2"} {
+		if err = queue.Push(ctx, "test", datum); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"1", "2"} {
+		if got := <-queue.Pop(ctx, "test"); got != want {
+			t.Fatalf("pop: got %q, want %q", got, want)
+		}
+	}
+
+	// 没有数据时Pop阻塞
+	select {
+	case data := <-queue.Pop(ctx, "test"):
+		t.Fatalf("pop on empty queue returned %q", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 队列满时Push阻塞直到ctx结束
+	_ = queue.Push(ctx, "test", "1")
+	_ = queue.Push(ctx, "test", "2")
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err = queue.Push(timeout, "test", "3"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("push to full queue: %v", err)
+	}
+
+	// 销毁队列会唤醒阻塞中的Push，并关闭数据通道
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- queue.Push(ctx, "test", "3")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	data := queue.Pop(ctx, "test")
+	if err = queue.Destroy(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-pushed; !errors.Is(err, memqueue.ErrQueueNotFound) {
+		t.Fatalf("push during destroy: %v", err)
+	}
+	for range data {
+	}
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"github.com/DanPlayer/exportcenter"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProgressRows(t *testing.T) {
+	// 时间间隔足够长，进度只会按行数间隔更新
+	center := newMemoryCenterWithOptions(t, exportcenter.Options{
+		SheetMaxRows:     10,
+		OutTime:          5 * time.Second,
+		ProgressInterval: time.Hour,
+		ProgressRows:     2,
+	})
+
+	id, keys, err := center.CreateTask("test_progress", "test_name", "", "", "", "jsonl", 6, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushData(keys[0], "[1]")
+	_ = center.PushData(keys[0], "{bad")
+	if err = center.StartTask(int64(id)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- center.Export(int64(id), filepath.Join(t.TempDir(), "test.jsonl"), nil)
+	}()
+
+	// 处理满2行后立即保存进度
+	task := waitWriteNum(t, center, int64(id), 2)
+	if task.ProgressRate != 33 || task.ErrNum != 1 {
+		t.Fatalf("unexpected stored progress: progress_rate=%d write_num=%d err_num=%d", task.ProgressRate, task.WriteNum, task.ErrNum)
+	}
+
+	progress, err := center.Progress(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Status != exportcenter.TaskStatusConsult || progress.CountNum != 6 || progress.WriteNum != 1 ||
+		progress.ErrNum != 1 || progress.ProgressRate != 33 || progress.Throughput <= 0 || progress.Eta <= 0 {
+		t.Fatalf("unexpected running progress %+v", progress)
+	}
+
+	_ = center.PushData(keys[0], "[1]")
+	_ = center.PushData(keys[0], "[1]")
+	task = waitWriteNum(t, center, int64(id), 4)
+	if task.ProgressRate != 66 || task.ErrNum != 1 {
+		t.Fatalf("unexpected stored progress: progress_rate=%d write_num=%d err_num=%d", task.ProgressRate, task.WriteNum, task.ErrNum)
+	}
+
+	_ = center.PushData(keys[0], "[1]")
+	_ = center.PushData(keys[0], "[1]")
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("export did not finish")
+	}
+
+	task, _ = center.GetTask(int64(id))
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.ProgressRate != 100 || task.ErrNum != 1 {
+		t.Fatalf("unexpected finished task: status=%d progress_rate=%d err_num=%d", task.Status, task.ProgressRate, task.ErrNum)
+	}
+	progress, err = center.Progress(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Status != exportcenter.TaskStatusCompleted || progress.ProgressRate != 100 ||
+		progress.WriteNum != 5 || progress.ErrNum != 1 || progress.Eta != 0 {
+		t.Fatalf("unexpected finished progress %+v", progress)
+	}
+}
+
+// waitWriteNum 等待任务记录的已处理数据数达到指定值
+func waitWriteNum(t *testing.T, center *exportcenter.ExportCenter, id, writeNum int64) exportcenter.Task {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		task, err := center.GetTask(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.WriteNum == writeNum {
+			return task
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("write_num is %d, want %d", task.WriteNum, writeNum)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,290 @@
+package test
+
+import (
+	"context"
+	"github.com/DanPlayer/exportcenter"
+	"github.com/DanPlayer/exportcenter/redis"
+	"github.com/alicebob/miniredis/v2"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMiniRedis 使用内嵌的redis服务创建客户端
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, *redis.Redis) {
+	server := miniredis.RunT(t)
+	client := redis.New(context.Background(), redis.Options{
+		Addr:       server.Addr(),
+		PopTimeout: time.Second,
+	})
+	t.Cleanup(func() {
+		_ = client.Point.Close()
+	})
+	return server, client
+}
+
+func TestRedisQueue(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMiniRedis(t)
+
+	err := client.CreateQueue(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, datum := range []string{"1", "2", "3"} {
+		if err = client.Push(ctx, "test", datum); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 先进先出，多次调用返回同一个通道
+	list := client.Pop(ctx, "test")
+	if client.Pop(ctx, "test") != list {
+		t.Fatal("pop returned a new channel")
+	}
+	for _, want := range []string{"1", "2", "3"} {
+		select {
+		case got := <-client.Pop(ctx, "test"):
+			if got != want {
+				t.Fatalf("pop: got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("pop %q timed out", want)
+		}
+	}
+
+	// 阻塞等待后推送的数据
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		_ = client.Push(ctx, "test", "4")
+	}()
+	select {
+	case got := <-list:
+		if got != "4" {
+			t.Fatalf("pop: got %q, want %q", got, "4")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking pop timed out")
+	}
+
+	// 销毁队列后删除数据，重新创建的队列使用新的消费协程
+	_ = client.Push(ctx, "test", "5")
+	if err = client.Destroy(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists("test") {
+		t.Fatal("queue was not deleted")
+	}
+	_ = client.CreateQueue(ctx, "test")
+	_ = client.Push(ctx, "test", "6")
+	if client.Pop(ctx, "test") == list {
+		t.Fatal("destroyed queue reused the old channel")
+	}
+	select {
+	case got := <-client.Pop(ctx, "test"):
+		if got != "6" {
+			t.Fatalf("pop: got %q, want %q", got, "6")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pop recreated queue timed out")
+	}
+}
+
+func TestRedisQueueReuseAfterDestroy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, client := newMiniRedis(t)
+
+	queues := map[string]exportcenter.Queue{
+		"redis":    client,
+		"reliable": redis.NewReliableQueue(ctx, client, redis.ReliableOptions{ConsumerID: "alive"}),
+		"stream":   redis.NewStreamQueue(client, redis.StreamOptions{}),
+	}
+	for name, queue := range queues {
+		t.Run(name, func(t *testing.T) {
+			key := "test_reuse_" + name
+			if err := queue.CreateQueue(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			// 消费协程阻塞拉取时销毁队列，通道关闭
+			list := queue.Pop(ctx, key)
+			time.Sleep(100 * time.Millisecond)
+			if err := queue.Destroy(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case data, ok := <-list:
+				if ok {
+					t.Fatalf("destroyed queue delivered %q", data)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("channel of destroyed queue was not closed")
+			}
+
+			// 重新创建同名队列，推送的数据不会被旧的消费协程取走
+			if err := queue.CreateQueue(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			if err := queue.Push(ctx, key, "1"); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-queue.Pop(ctx, key):
+				if got != "1" {
+					t.Fatalf("pop: got %q, want %q", got, "1")
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("pop recreated queue timed out")
+			}
+			_ = queue.Destroy(ctx, key)
+		})
+	}
+	if keys := server.Keys(); len(keys) > 0 {
+		for _, key := range keys {
+			if strings.HasPrefix(key, "test_reuse_") {
+				t.Fatalf("key %s was not deleted", key)
+			}
+		}
+	}
+}
+
+func TestReliableQueueRecover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, client := newMiniRedis(t)
+
+	dead := redis.NewReliableQueue(ctx, client, redis.ReliableOptions{ConsumerID: "dead"})
+	_ = dead.CreateQueue(ctx, "test")
+	for _, datum := range []string{"1", "2", "3"} {
+		_ = dead.Push(ctx, "test", datum)
+	}
+
+	// 确认的数据从处理中列表删除，未确认以及消费协程预取的数据保留
+	for _, want := range []string{"1", "2"} {
+		select {
+		case got := <-dead.Pop(ctx, "test"):
+			if got != want {
+				t.Fatalf("pop: got %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("pop %q timed out", want)
+		}
+	}
+	if err := dead.Ack(ctx, "test", "1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if items, _ := server.List("test:processing:dead"); len(items) != 2 || items[0] != "3" || items[1] != "2" {
+		t.Fatalf("unexpected processing list: %v", items)
+	}
+
+	// 消费者心跳过期后，其他消费者恢复未确认的数据并优先消费
+	server.Del("ec_reliable:heartbeat:dead")
+	alive := redis.NewReliableQueue(ctx, client, redis.ReliableOptions{ConsumerID: "alive"})
+	if err := alive.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists("test:processing:dead") {
+		t.Fatal("processing list was not recovered")
+	}
+	for _, want := range []string{"2", "3"} {
+		select {
+		case got := <-alive.Pop(ctx, "test"):
+			if got != want {
+				t.Fatalf("pop: got %q, want %q", got, want)
+			}
+			_ = alive.Ack(ctx, "test", got)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("pop %q timed out", want)
+		}
+	}
+
+	if err := alive.Destroy(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists("test:processing:alive") || server.Exists("test:consumers") {
+		t.Fatal("processing lists were not deleted")
+	}
+}
+
+func TestStreamQueueClaim(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, client := newMiniRedis(t)
+
+	first := redis.NewStreamQueue(client, redis.StreamOptions{Consumer: "first", ClaimIdle: time.Second})
+	second := redis.NewStreamQueue(client, redis.StreamOptions{Consumer: "second", ClaimIdle: time.Second})
+	if err := first.CreateQueue(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// 消费组已存在时忽略
+	if err := second.CreateQueue(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	_ = first.Push(ctx, "test", "1")
+
+	// 第一个消费者拉取后未确认
+	select {
+	case got := <-first.Pop(ctx, "test"):
+		if got != "1" {
+			t.Fatalf("pop: got %q, want %q", got, "1")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pop timed out")
+	}
+
+	// 超过认领时间后由第二个消费者重新投递
+	server.FastForward(2 * time.Second)
+	select {
+	case got := <-second.Pop(ctx, "test"):
+		if got != "1" {
+			t.Fatalf("claim: got %q, want %q", got, "1")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("claim timed out")
+	}
+	if err := second.Ack(ctx, "test", "1"); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := client.Point.XPending(ctx, "test", "exportcenter").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("got %d pending messages, want 0", pending.Count)
+	}
+
+	if err = second.Destroy(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists("test") {
+		t.Fatal("stream was not deleted")
+	}
+}
+
+func TestRedisPushBatch(t *testing.T) {
+	ctx := context.Background()
+	_, client := newMiniRedis(t)
+
+	data := make([]string, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		data = append(data, strconv.Itoa(i))
+	}
+	if err := client.PushBatch(ctx, "test", data); err != nil {
+		t.Fatal(err)
+	}
+
+	// 跨越多条命令的批量数据依然先进先出
+	list := client.Pop(ctx, "test")
+	for _, want := range data {
+		select {
+		case got := <-list:
+			if got != want {
+				t.Fatalf("pop: got %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("pop %q timed out", want)
+		}
+	}
+}
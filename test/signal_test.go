@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/DanPlayer/exportcenter"
+	"github.com/DanPlayer/exportcenter/redis"
+	"testing"
+	"time"
+)
+
+// testSignaler 校验开启信号先发送后等待、先等待后发送以及清除信号
+func testSignaler(t *testing.T, signaler exportcenter.Signaler) {
+	ctx := context.Background()
+
+	// 没有信号时等待超时
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := signaler.Wait(timeout, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait without signal: %v", err)
+	}
+
+	// 先发送信号后等待，重复发送不报错
+	if err := signaler.Notify(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := signaler.Notify(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := signaler.Wait(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 先等待后发送信号
+	waited := make(chan error, 1)
+	go func() {
+		waited <- signaler.Wait(ctx, 2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := signaler.Notify(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait was not woken by notify")
+	}
+
+	// 清除信号后需要重新开启，不影响其他任务的信号
+	if err := signaler.Clear(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := signaler.Wait(timeout, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait after clear: %v", err)
+	}
+	if err := signaler.Wait(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemorySignaler(t *testing.T) {
+	testSignaler(t, exportcenter.NewMemorySignaler())
+}
+
+func TestDbSignaler(t *testing.T) {
+	signaler, err := exportcenter.NewDbSignaler(newSqlite(t), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSignaler(t, signaler)
+}
+
+func TestRedisSignaler(t *testing.T) {
+	server, client := newMiniRedis(t)
+	testSignaler(t, redis.NewSignaler(client, "test_signal", time.Minute))
+
+	// 信号键按配置的时间过期
+	if ttl := server.TTL("test_signal:2"); ttl != time.Minute {
+		t.Fatalf("signal key ttl is %s, want 1m", ttl)
+	}
+	if server.Exists("test_signal:1") {
+		t.Fatal("signal key was not cleared")
+	}
+}
+
+func TestDbSignalerExport(t *testing.T) {
+	// 接口服务与导出服务通过数据库共享任务与开启信号
+	db := newSqlite(t)
+	signaler, err := exportcenter.NewDbSignaler(db, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center := newMemoryCenterWithOptions(t, exportcenter.Options{SheetMaxRows: 10, Signaler: signaler})
+
+	id, keys, err := center.CreateTask("test_db_signal", "test_name", "", "", "", "jsonl", 1, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := make(chan error, 1)
+	go func() {
+		exported <- center.Export(int64(id), t.TempDir()+"/test.jsonl", nil)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	_ = center.PushData(keys[0], "[1]")
+	if err = center.StartTask(int64(id)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-exported:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("export was not started by the database signal")
+	}
+
+	task, _ := center.GetTask(int64(id))
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() {
+		t.Fatalf("task status is %d, want completed", task.Status)
+	}
+	// 开始导出后清除信号
+	var count int64
+	db.Model(&exportcenter.TaskSignal{}).Where("task_id = ?", id).Count(&count)
+	if count != 0 {
+		t.Fatalf("signal was not cleared, %d rows left", count)
+	}
+}
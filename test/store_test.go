@@ -0,0 +1,228 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/DanPlayer/exportcenter"
+	"github.com/DanPlayer/exportcenter/memqueue"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSqlite 在临时目录创建SQLite数据库，只使用一个连接避免并发写入时锁库
+func newSqlite(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return db
+}
+
+// testTaskStore 校验任务存储的所有方法以及已结束任务的状态保护
+func testTaskStore(t *testing.T, store exportcenter.TaskStore) {
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, 100000); !errors.Is(err, exportcenter.ErrTaskNotFound) {
+		t.Fatalf("get missing task: %v", err)
+	}
+
+	task := exportcenter.Task{Name: "test", Status: exportcenter.TaskStatusWait.ParseInt(), QueueKey: "test", CountNum: 10}
+	if err := store.Create(ctx, &task); err != nil {
+		t.Fatal(err)
+	}
+	if task.ID == 0 {
+		t.Fatal("task id not set after create")
+	}
+	id := int64(task.ID)
+
+	if err := store.UpdateStatus(ctx, id, exportcenter.TaskStatusConsult); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateProgress(ctx, id, 50, 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	// 数据未变化时不返回错误
+	if err := store.UpdateProgress(ctx, id, 50, 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateCount(ctx, id, 8); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateDownloadUrl(ctx, id, "/tmp/test.xlsx"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != exportcenter.TaskStatusConsult.ParseInt() || !got.StartTime.Valid || got.ProgressRate != 50 ||
+		got.WriteNum != 5 || got.ErrNum != 1 || got.CountNum != 8 || got.DownloadUrl != "/tmp/test.xlsx" {
+		t.Fatalf("unexpected task %+v", got)
+	}
+
+	if err = store.Complete(ctx, id, 8); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = store.Get(ctx, id)
+	if got.Status != exportcenter.TaskStatusCompleted.ParseInt() || got.ProgressRate != 100 || got.WriteNum != 8 || !got.EndTime.Valid {
+		t.Fatalf("unexpected completed task %+v", got)
+	}
+
+	// 已结束的任务不能再更新状态、进度与下载地址，错误日志地址不受限制
+	finished := []func() error{
+		func() error { return store.UpdateStatus(ctx, id, exportcenter.TaskStatusConsult) },
+		func() error { return store.UpdateProgress(ctx, id, 10, 1, 0) },
+		func() error { return store.UpdateCount(ctx, id, 1) },
+		func() error { return store.Complete(ctx, id, 1) },
+		func() error { return store.Fail(ctx, id, 1, 1) },
+		func() error { return store.Abandon(ctx, id) },
+		func() error { return store.UpdateDownloadUrl(ctx, id, "/tmp/other.xlsx") },
+	}
+	for i, update := range finished {
+		if err = update(); !errors.Is(err, exportcenter.ErrTaskFinished) {
+			t.Fatalf("update %d of finished task: %v", i, err)
+		}
+	}
+	if err = store.UpdateErrLogUrl(ctx, id, "/tmp/test.log"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = store.Get(ctx, id)
+	if got.Status != exportcenter.TaskStatusCompleted.ParseInt() || got.WriteNum != 8 || got.DownloadUrl != "/tmp/test.xlsx" || got.ErrLogUrl != "/tmp/test.log" {
+		t.Fatalf("finished task was modified %+v", got)
+	}
+
+	// 失败与废弃
+	for _, status := range []exportcenter.TaskStatus{exportcenter.TaskStatusFail, exportcenter.TaskStatusAbandon} {
+		task = exportcenter.Task{Name: "test", Status: exportcenter.TaskStatusWait.ParseInt(), QueueKey: "test"}
+		if err = store.Create(ctx, &task); err != nil {
+			t.Fatal(err)
+		}
+		id = int64(task.ID)
+		if status == exportcenter.TaskStatusFail {
+			err = store.Fail(ctx, id, 2, 3)
+		} else {
+			err = store.Abandon(ctx, id)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ = store.Get(ctx, id)
+		if got.Status != status.ParseInt() || !got.EndTime.Valid {
+			t.Fatalf("unexpected task %+v, want status %d", got, status)
+		}
+		if err = store.Complete(ctx, id, 3); !errors.Is(err, exportcenter.ErrTaskFinished) {
+			t.Fatalf("complete task with status %d: %v", status, err)
+		}
+	}
+
+	if err = store.UpdateProgress(ctx, 100000, 1, 1, 1); !errors.Is(err, exportcenter.ErrTaskNotFound) {
+		t.Fatalf("update missing task: %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testTaskStore(t, exportcenter.NewMemoryStore())
+}
+
+func TestGormStore(t *testing.T) {
+	db := newSqlite(t)
+	store, err := exportcenter.NewGormStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasTable(&exportcenter.Task{}) {
+		t.Fatal("task table was not created")
+	}
+	// 重复迁移不影响已有的表
+	if _, err = exportcenter.NewGormStore(db); err != nil {
+		t.Fatal(err)
+	}
+	testTaskStore(t, store)
+}
+
+func TestGormStoreExport(t *testing.T) {
+	center, err := exportcenter.NewClient(exportcenter.Options{
+		Db:           newSqlite(t),
+		Queue:        memqueue.New(memqueue.Options{}),
+		SheetMaxRows: 10,
+		LogRootPath:  t.TempDir(),
+		OutTime:      500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, keys, err := center.CreateTask("test_gorm", "test_name", "", "", "", "csv", 2, exportcenter.ExportOptions{
+		Header: []string{"name", "amount"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = center.PushData(keys[0], `["a",1]`)
+	_ = center.PushData(keys[0], `["b",2]`)
+	_ = center.StartTask(int64(id))
+
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	if err = center.Export(int64(id), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := center.GetTask(int64(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != exportcenter.TaskStatusCompleted.ParseInt() || task.WriteNum != 2 || task.ProgressRate != 100 ||
+		task.DownloadUrl != filePath || task.ErrLogUrl == "" {
+		t.Fatalf("unexpected task %+v", task)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "name,amount\r\na,1\r\nb,2\r\n" {
+		t.Fatalf("unexpected file %q", data)
+	}
+}
+
+func TestCancelledTaskCannotFinish(t *testing.T) {
+	center := newMemoryCenter(t, 10)
+
+	id, _, err := center.CreateTask("test_cancel_finish", "test_name", "", "", "", "csv", 1, exportcenter.ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = center.CancelTask(int64(id)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 废弃的任务不能被标记为完成或失败，也不能记录下载地址
+	if err = center.CompleteTask(int64(id), 1); !errors.Is(err, exportcenter.ErrTaskFinished) {
+		t.Fatalf("complete cancelled task: %v", err)
+	}
+	if err = center.FailTask(int64(id), 1, 1); !errors.Is(err, exportcenter.ErrTaskFinished) {
+		t.Fatalf("fail cancelled task: %v", err)
+	}
+	if err = center.UpdateTaskDownloadUrl(int64(id), "/tmp/test.csv"); !errors.Is(err, exportcenter.ErrTaskFinished) {
+		t.Fatalf("update download url of cancelled task: %v", err)
+	}
+	if err = center.CancelTask(int64(id)); !errors.Is(err, exportcenter.ErrTaskFinished) {
+		t.Fatalf("cancel cancelled task: %v", err)
+	}
+	task, _ := center.GetTask(int64(id))
+	if task.Status != exportcenter.TaskStatusAbandon.ParseInt() || task.DownloadUrl != "" {
+		t.Fatalf("unexpected task: status=%d download_url=%q", task.Status, task.DownloadUrl)
+	}
+}
@@ -0,0 +1,85 @@
+package exportcenter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 内置导出格式
+const (
+	FormatXlsx  = "xlsx"
+	FormatCsv   = "csv"
+	FormatJsonl = "jsonl"
+)
+
+// Writer 导出文件写入器，每种导出格式对应一个写入器
+type Writer interface {
+	Open(filePath string, options ExportOptions) error // 打开文件
+	NewSheet(name string) (SheetWriter, error)         // 创建数据表，每个数据表由单独的协程写入
+	Save() (string, error)                             // 保存文件，返回最终文件路径（部分格式会改变文件扩展名）
+	Close() error                                      // 关闭写入器，释放资源
+}
+
+// SheetWriter 数据表写入器
+type SheetWriter interface {
+	WriteRow(values []interface{}) error // 写入一行数据
+	Flush() error                        // 数据表写入完成
+}
+
+// WriterFactory 写入器构造函数，每次导出都会创建新的写入器
+type WriterFactory func() Writer
+
+var (
+	writers   = make(map[string]WriterFactory)
+	writersMu sync.RWMutex
+)
+
+func init() {
+	RegisterWriter(FormatXlsx, func() Writer { return &xlsxWriter{} })
+	RegisterWriter(FormatCsv, func() Writer { return &csvWriter{} })
+	RegisterWriter(FormatJsonl, func() Writer { return &jsonlWriter{} })
+}
+
+// RegisterWriter 注册导出格式写入器，格式名称不区分大小写，重复注册会覆盖原有写入器
+func RegisterWriter(format string, factory WriterFactory) {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+	writers[strings.ToLower(format)] = factory
+}
+
+// NewWriter 根据导出格式创建写入器，格式为空时默认使用xlsx
+func NewWriter(format string) (Writer, error) {
+	if format == "" {
+		format = FormatXlsx
+	}
+
+	writersMu.RLock()
+	factory, ok := writers[strings.ToLower(format)]
+	writersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的导出格式：%s", format)
+	}
+	return factory(), nil
+}
+
+// cellString 将单元格数据转换为文本
+func cellString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,373 @@
+package exportcenter
+
+import (
+	"github.com/xuri/excelize/v2"
+	"sync"
+	"unicode/utf8"
+)
+
+// autoFitRows 自动列宽时每个数据表用于计算列宽的数据行数，之后的数据直接写入不再缓存
+const autoFitRows = 100
+
+// autoFitMaxWidth 自动列宽的最大宽度
+const autoFitMaxWidth = 60
+
+// XlsxOptions xlsx导出选项
+type XlsxOptions struct {
+	HeaderStyle  *HeaderStyle `json:"header_style,omitempty"`  // 表头样式
+	FreezeHeader bool         `json:"freeze_header,omitempty"` // 冻结表头行
+	FreezeCols   int          `json:"freeze_cols,omitempty"`   // 冻结左侧的列数
+	AutoFilter   bool         `json:"auto_filter,omitempty"`   // 表头开启筛选，范围为表头与所有数据行
+	AutoFit      bool         `json:"auto_fit,omitempty"`      // 根据表头与每个数据表前100行的内容自动设置列宽
+	ColWidth     float64      `json:"col_width,omitempty"`     // 默认列宽，列配置了Width时以列配置为准
+}
+
+// HeaderStyle 表头样式
+type HeaderStyle struct {
+	Bold      bool   `json:"bold,omitempty"`       // 加粗
+	FontColor string `json:"font_color,omitempty"` // 字体颜色，如#FFFFFF
+	FillColor string `json:"fill_color,omitempty"` // 背景色，如#D9D9D9
+	Border    bool   `json:"border,omitempty"`     // 细边框
+	Align     string `json:"align,omitempty"`      // 水平对齐方式left、center、right
+}
+
+// xlsxWriter excel写入器，每个数据表使用独立的流式写入器
+type xlsxWriter struct {
+	file         *excelize.File
+	filePath     string
+	options      XlsxOptions
+	header       *headerLayout
+	headerStyles []int // 各列表头单元格的样式
+	columns      []Column
+	styles       []int // 各列数据单元格的样式，0为默认样式
+	sheets       int
+	lock         sync.Mutex
+}
+
+func (w *xlsxWriter) Open(filePath string, options ExportOptions) error {
+	w.file = excelize.NewFile()
+	w.filePath = filePath
+	if options.Xlsx != nil {
+		w.options = *options.Xlsx
+	}
+	if len(options.HeaderTree) > 0 {
+		w.header = newHeaderLayout(options.HeaderTree)
+	} else if len(options.Header) > 0 {
+		row := make([]interface{}, 0, len(options.Header))
+		for _, s := range options.Header {
+			row = append(row, s)
+		}
+		w.header = &headerLayout{rows: [][]interface{}{row}}
+	}
+
+	// 根据列的数字格式与对齐方式创建样式
+	w.columns = options.Columns
+	w.styles = make([]int, len(options.Columns))
+	for i, column := range options.Columns {
+		numFmt := column.defaultNumFmt()
+		if numFmt == "" && column.Align == "" {
+			continue
+		}
+		style := &excelize.Style{}
+		if numFmt != "" {
+			style.CustomNumFmt = &numFmt
+		}
+		if column.Align != "" {
+			style.Alignment = &excelize.Alignment{Horizontal: column.Align}
+		}
+		styleID, err := w.file.NewStyle(style)
+		if err != nil {
+			return err
+		}
+		w.styles[i] = styleID
+	}
+
+	if w.options.HeaderStyle != nil {
+		styleID, err := w.file.NewStyle(w.options.HeaderStyle.style())
+		if err != nil {
+			return err
+		}
+		w.headerStyles = make([]int, w.colCount())
+		for i := range w.headerStyles {
+			w.headerStyles[i] = styleID
+		}
+	}
+	return nil
+}
+
+func (w *xlsxWriter) NewSheet(name string) (SheetWriter, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.sheets++
+	if w.sheets == 1 {
+		// 新建文件默认带有Sheet1，直接重命名使用
+		if name != "Sheet1" {
+			if err := w.file.SetSheetName("Sheet1", name); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if _, err := w.file.NewSheet(name); err != nil {
+			return nil, err
+		}
+	}
+
+	// 获取写入器
+	sw, err := w.file.NewStreamWriter(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &xlsxSheet{w: w, name: name, sw: sw}
+	if w.options.AutoFit {
+		// 列宽与冻结窗格必须在写入数据之前设置，自动列宽时先缓存数据，计算列宽后再写入
+		sheet.fit = make([]float64, 0, w.colCount())
+	} else if err = sheet.start(); err != nil {
+		return nil, err
+	}
+	// 生成标题，数据从最后一行表头之后开始写入
+	if w.header != nil {
+		for i, row := range w.header.rows {
+			// 合并单元格只计算最后一行表头的列宽，避免分组标题撑宽叶子列
+			if err = sheet.writeRow(row, w.headerStyles, i == len(w.header.rows)-1); err != nil {
+				return nil, err
+			}
+		}
+		for _, merge := range w.header.merges {
+			if err = sw.MergeCell(merge[0], merge[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sheet, nil
+}
+
+func (w *xlsxWriter) Save() (string, error) {
+	return w.filePath, w.file.SaveAs(w.filePath)
+}
+
+func (w *xlsxWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// headerRows 表头行数
+func (w *xlsxWriter) headerRows() int {
+	if w.header == nil {
+		return 0
+	}
+	return len(w.header.rows)
+}
+
+// colCount 表头与列配置的列数
+func (w *xlsxWriter) colCount() int {
+	cols := 0
+	if w.header != nil {
+		cols = len(w.header.rows[0])
+	}
+	if len(w.columns) > cols {
+		return len(w.columns)
+	}
+	return cols
+}
+
+// style 转换为excel样式
+func (h *HeaderStyle) style() *excelize.Style {
+	style := &excelize.Style{}
+	if h.Bold || h.FontColor != "" {
+		style.Font = &excelize.Font{Bold: h.Bold, Color: h.FontColor}
+	}
+	if h.FillColor != "" {
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{h.FillColor}}
+	}
+	if h.Border {
+		for _, side := range []string{"left", "top", "right", "bottom"} {
+			style.Border = append(style.Border, excelize.Border{Type: side, Color: "000000", Style: 1})
+		}
+	}
+	if h.Align != "" {
+		style.Alignment = &excelize.Alignment{Horizontal: h.Align, Vertical: "center"}
+	}
+	return style
+}
+
+// xlsxSheet excel数据表
+type xlsxSheet struct {
+	w       *xlsxWriter
+	name    string
+	sw      *excelize.StreamWriter
+	row     int
+	fit     []float64       // 自动列宽时各列内容的最大宽度，开始写入后为nil
+	pending [][]interface{} // 自动列宽时缓存的数据行
+	cells   []interface{}
+}
+
+func (s *xlsxSheet) WriteRow(values []interface{}) error {
+	return s.writeRow(values, s.w.styles, true)
+}
+
+func (s *xlsxSheet) Flush() error {
+	if s.fit != nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	// 筛选与结束写入都会修改工作簿的共享数据，多个数据表并发写入时需要加锁
+	s.w.lock.Lock()
+	defer s.w.lock.Unlock()
+
+	// 筛选范围为最后一行表头到最后一行数据
+	headerRows := s.w.headerRows()
+	if s.w.options.AutoFilter && headerRows > 0 {
+		from, err := excelize.CoordinatesToCellName(1, headerRows)
+		if err != nil {
+			return err
+		}
+		to, err := excelize.CoordinatesToCellName(s.w.colCount(), s.row)
+		if err != nil {
+			return err
+		}
+		if err = s.w.file.AutoFilter(s.name, from+":"+to, nil); err != nil {
+			return err
+		}
+	}
+	return s.sw.Flush()
+}
+
+// writeRow 按样式写入一行，自动列宽时缓存至autoFitRows行数据后统一写入，fit为false的行不参与列宽计算
+func (s *xlsxSheet) writeRow(values []interface{}, styles []int, fit bool) error {
+	if s.fit == nil {
+		s.cells = s.toCells(s.cells[:0], values, styles)
+		return s.setRow(s.cells)
+	}
+
+	if fit {
+		s.measure(values)
+	}
+	s.pending = append(s.pending, s.toCells(nil, values, styles))
+	if len(s.pending) <= s.w.headerRows()+autoFitRows {
+		return nil
+	}
+	return s.start()
+}
+
+// start 设置列宽与冻结窗格，写入缓存的数据行
+func (s *xlsxSheet) start() error {
+	cols := s.w.colCount()
+	if len(s.fit) > cols {
+		cols = len(s.fit)
+	}
+	for i := 0; i < cols; i++ {
+		width := s.w.options.ColWidth
+		if i < len(s.fit) {
+			width = s.fit[i]
+		}
+		if i < len(s.w.columns) && s.w.columns[i].Width > 0 {
+			width = s.w.columns[i].Width
+		}
+		if width <= 0 {
+			continue
+		}
+		if err := s.sw.SetColWidth(i+1, i+1, width); err != nil {
+			return err
+		}
+	}
+
+	if panes := s.panes(); panes != nil {
+		if err := s.sw.SetPanes(panes); err != nil {
+			return err
+		}
+	}
+
+	pending := s.pending
+	s.fit, s.pending = nil, nil
+	for _, cells := range pending {
+		if err := s.setRow(cells); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// panes 冻结窗格配置，未冻结时为nil
+func (s *xlsxSheet) panes() *excelize.Panes {
+	rows, cols := 0, s.w.options.FreezeCols
+	if s.w.options.FreezeHeader {
+		rows = s.w.headerRows()
+	}
+	if rows <= 0 && cols <= 0 {
+		return nil
+	}
+
+	pane := "bottomRight"
+	if cols <= 0 {
+		pane = "bottomLeft"
+	} else if rows <= 0 {
+		pane = "topRight"
+	}
+	cell, _ := excelize.CoordinatesToCellName(cols+1, rows+1)
+	return &excelize.Panes{
+		Freeze:      true,
+		XSplit:      cols,
+		YSplit:      rows,
+		TopLeftCell: cell,
+		ActivePane:  pane,
+		Selection:   []excelize.Selection{{SQRef: cell, ActiveCell: cell, Pane: pane}},
+	}
+}
+
+// measure 统计各列内容的宽度，非ASCII字符按两个字符计算
+func (s *xlsxSheet) measure(values []interface{}) {
+	for i, value := range values {
+		width := 2.0
+		for _, r := range cellString(value) {
+			if r < utf8.RuneSelf {
+				width++
+			} else {
+				width += 2
+			}
+		}
+		if width > autoFitMaxWidth {
+			width = autoFitMaxWidth
+		}
+		if i >= len(s.fit) {
+			s.fit = append(s.fit, width)
+		} else if width > s.fit[i] {
+			s.fit[i] = width
+		}
+	}
+}
+
+// toCells 转换为单元格，日期时间写入日期值，未配置类型的列长整数按文本写入，配置了样式的列使用带样式的单元格
+func (s *xlsxSheet) toCells(cells, values []interface{}, styles []int) []interface{} {
+	for i, value := range values {
+		if t, ok := value.(timeCell); ok {
+			value = t.t
+		} else if i >= len(s.w.columns) || s.w.columns[i].Type == "" {
+			value = generalCell(value)
+		}
+		if i < len(styles) && styles[i] != 0 {
+			value = excelize.Cell{StyleID: styles[i], Value: value}
+		}
+		cells = append(cells, value)
+	}
+	return cells
+}
+
+func (s *xlsxSheet) setRow(cells []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, s.row+1)
+	if err != nil {
+		return err
+	}
+	if err = s.sw.SetRow(cell, cells); err != nil {
+		return err
+	}
+	s.row++
+	return nil
+}